@@ -0,0 +1,49 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+// hexColorRegex matches a CSS hex color, e.g. `#f80` or `#ff8800cc`.
+var hexColorRegex = regexp.MustCompile(`^#([[:xdigit:]]{3,4}|[[:xdigit:]]{6}|[[:xdigit:]]{8})$`)
+
+// cssColorNames lists the named colors of CSS Color Module Level 4.
+var cssColorNames = strings.Fields(`
+	aliceblue antiquewhite aqua aquamarine azure beige bisque black
+	blanchedalmond blue blueviolet brown burlywood cadetblue chartreuse
+	chocolate coral cornflowerblue cornsilk crimson cyan darkblue darkcyan
+	darkgoldenrod darkgray darkgreen darkgrey darkkhaki darkmagenta
+	darkolivegreen darkorange darkorchid darkred darksalmon darkseagreen
+	darkslateblue darkslategray darkslategrey darkturquoise darkviolet
+	deeppink deepskyblue dimgray dimgrey dodgerblue firebrick floralwhite
+	forestgreen fuchsia gainsboro ghostwhite gold goldenrod gray green
+	greenyellow grey honeydew hotpink indianred indigo ivory khaki lavender
+	lavenderblush lawngreen lemonchiffon lightblue lightcoral lightcyan
+	lightgoldenrodyellow lightgray lightgreen lightgrey lightpink
+	lightsalmon lightseagreen lightskyblue lightslategray lightslategrey
+	lightsteelblue lightyellow lime limegreen linen magenta maroon
+	mediumaquamarine mediumblue mediumorchid mediumpurple mediumseagreen
+	mediumslateblue mediumspringgreen mediumturquoise mediumvioletred
+	midnightblue mintcream mistyrose moccasin navajowhite navy oldlace olive
+	olivedrab orange orangered orchid palegoldenrod palegreen paleturquoise
+	palevioletred papayawhip peachpuff peru pink plum powderblue purple
+	rebeccapurple red rosybrown royalblue saddlebrown salmon sandybrown
+	seagreen seashell sienna silver skyblue slateblue slategray slategrey
+	snow springgreen steelblue tan teal thistle tomato turquoise violet
+	wheat white whitesmoke yellow yellowgreen
+`)
+
+// isValidColor returns whether the given value is a CSS hex or named color.
+func isValidColor(color string) bool {
+	if hexColorRegex.MatchString(color) {
+		return true
+	}
+	color = strings.ToLower(color)
+	for _, name := range cssColorNames {
+		if color == name {
+			return true
+		}
+	}
+	return false
+}
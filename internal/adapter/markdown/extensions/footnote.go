@@ -0,0 +1,65 @@
+package extensions
+
+import (
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// InlineFootnote represents an inline footnote in a Markdown document, e.g.
+// ^[A footnote].
+type InlineFootnote struct {
+	ast.BaseInline
+	// Segment of the footnote content, without the delimiters.
+	Segment text.Segment
+}
+
+func (n *InlineFootnote) Dump(source []byte, level int) {
+	m := map[string]string{}
+	m["Content"] = string(n.Segment.Value(source))
+	ast.DumpHelper(n, source, level, m, nil)
+}
+
+// KindInlineFootnote is a NodeKind of the InlineFootnote node.
+var KindInlineFootnote = ast.NewNodeKind("InlineFootnote")
+
+func (n *InlineFootnote) Kind() ast.NodeKind {
+	return KindInlineFootnote
+}
+
+// InlineFootnoteExt is an extension parsing Pandoc's inline footnotes, e.g.
+// ^[A footnote].
+type InlineFootnoteExt struct{}
+
+func (e *InlineFootnoteExt) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithInlineParsers(
+			util.Prioritized(&inlineFootnoteParser{}, 199),
+		),
+	)
+}
+
+type inlineFootnoteParser struct{}
+
+func (p *inlineFootnoteParser) Trigger() []byte {
+	return []byte{'^'}
+}
+
+func (p *inlineFootnoteParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, segment := block.PeekLine()
+	if len(line) < 3 || line[1] != '[' {
+		return nil
+	}
+
+	closure := util.FindClosure(line[2:], '[', ']', true, true)
+	if closure < 0 {
+		return nil
+	}
+
+	block.Advance(closure + 3)
+	return &InlineFootnote{
+		Segment: text.NewSegment(segment.Start+2, segment.Start+2+closure),
+	}
+}
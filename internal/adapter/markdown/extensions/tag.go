@@ -16,6 +16,8 @@ type Tags struct {
 	ast.BaseInline
 	// Tags in this list.
 	Tags []string
+	// Start is the byte offset of the tags in the source.
+	Start int
 }
 
 func (n *Tags) Dump(source []byte, level int) {
@@ -78,7 +80,7 @@ func (p *hashtagParser) Trigger() []byte {
 
 func (p *hashtagParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
 	previousChar := block.PrecendingCharacter()
-	line, _ := block.PeekLine()
+	line, segment := block.PeekLine()
 
 	// A hashtag can't be directly preceded by a # or any other valid character.
 	if isValidTagChar(previousChar, '\x00') {
@@ -169,6 +171,7 @@ func (p *hashtagParser) Parse(parent ast.Node, block text.Reader, pc parser.Cont
 	return &Tags{
 		BaseInline: ast.BaseInline{},
 		Tags:       []string{tag},
+		Start:      segment.Start,
 	}
 }
 
@@ -190,7 +193,7 @@ func (p *colontagParser) Trigger() []byte {
 
 func (p *colontagParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
 	previousChar := block.PrecendingCharacter()
-	line, _ := block.PeekLine()
+	line, segment := block.PeekLine()
 
 	// A colontag can't be directly preceded by a : or any other valid character.
 	if isValidTagChar(previousChar, '\x00') {
@@ -249,11 +252,14 @@ func (p *colontagParser) Parse(parent ast.Node, block text.Reader, pc parser.Con
 	return &Tags{
 		BaseInline: ast.BaseInline{},
 		Tags:       tags,
+		Start:      segment.Start,
 	}
 }
 
+// isValidTagChar returns whether r can be part of a tag. Combining marks are
+// accepted to support decomposed accents and scripts such as Devanagari.
 func isValidTagChar(r rune, excluded rune) bool {
-	return r != excluded && (unicode.IsLetter(r) || unicode.IsNumber(r) ||
+	return r != excluded && (unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsNumber(r) ||
 		r == '/' || r == '@' || r == '\'' || r == '~' ||
 		r == '-' || r == '_' || r == '$' || r == '%' ||
 		r == '&' || r == '+' || r == '=' || r == ':' ||
@@ -1,7 +1,9 @@
 package extensions
 
 import (
+	"bytes"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/zk-org/zk/internal/core"
 	"github.com/yuin/goldmark"
@@ -13,32 +15,66 @@ import (
 
 // WikiLinkExt is an extension parsing wiki links and Neuron's Folgezettel.
 //
-// For example, [[wiki link]], [[[legacy downlink]]], #[[uplink]], [[downlink]]#.
-var WikiLinkExt = &wikiLink{}
-
-type wikiLink struct{}
+// For example, [[wiki link]], [[[legacy downlink]]], #[[uplink]], [[downlink]]#,
+// ![[embed]].
+//
+// Curly quotes wrapping the target are stripped, as inserted by word
+// processors, e.g. [[“wiki link”]]. The fullwidth brackets of CJK input
+// methods are accepted as well, e.g. ［［wiki link］］.
+type WikiLinkExt struct {
+	// Indicates whether the label is written before the target, e.g.
+	// [[label | target]] instead of [[target | label]].
+	LabelFirst bool
+	// Indicates whether wiki links targeting a #tag are parsed as tags, e.g.
+	// [[#tag]].
+	TagEnabled bool
+}
 
 // WikiLink represents a wiki link found in a Markdown document.
 type WikiLink struct {
 	ast.Link
+	// Start is the byte offset of the link in the source.
+	Start int
+	// Indicates whether the target is embedded, e.g. ![[note]].
+	Embed bool
 }
 
-func (w *wikiLink) Extend(m goldmark.Markdown) {
+func (w *WikiLinkExt) Extend(m goldmark.Markdown) {
+	wl := &wlParser{
+		labelFirst: w.LabelFirst,
+		tagEnabled: w.TagEnabled,
+	}
 	m.Parser().AddOptions(
 		parser.WithInlineParsers(
-			util.Prioritized(&wlParser{}, 199),
+			util.Prioritized(wl, 199),
+		),
+		parser.WithASTTransformers(
+			util.Prioritized(&wlFullwidthTransformer{parser: wl}, 199),
 		),
 	)
 }
 
-type wlParser struct{}
+type wlParser struct {
+	labelFirst bool
+	tagEnabled bool
+}
 
 func (p *wlParser) Trigger() []byte {
-	return []byte{'[', '#'}
+	return []byte{'[', '#', '!'}
 }
 
 func (p *wlParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
-	line, _ := block.PeekLine()
+	line, segment := block.PeekLine()
+
+	embed := false
+	if len(line) > 0 && line[0] == '!' {
+		// Other images are parsed by the default link parser.
+		if !bytes.HasPrefix(line, []byte("![[")) && !bytes.HasPrefix(line, []byte("!"+fullwidthOpener)) {
+			return nil
+		}
+		embed = true
+		line = line[1:]
+	}
 
 	var (
 		href  string
@@ -53,7 +89,8 @@ func (p *wlParser) Parse(parent ast.Node, block text.Reader, pc parser.Context)
 		parsingLabel    = false // Found a | in a Wikilink, now we parse the link's label
 		openerCharCount = 0     // Number of [ encountered
 		closerCharCount = 0     // Number of ] encountered
-		endPos          = 0     // Last position of the link in the line
+		closers         = ""    // Pending ] encountered, as written
+		endPos          = 0     // Number of bytes of the link in the line
 	)
 
 	appendRune := func(c rune) {
@@ -65,8 +102,6 @@ func (p *wlParser) Parse(parent ast.Node, block text.Reader, pc parser.Context)
 	}
 
 	for i, char := range string(line) {
-		endPos = i
-
 		if closed {
 			// Supports trailing hash syntax for Neuron's Folgezettel, e.g. [[id]]#
 			if char == '#' {
@@ -74,14 +109,19 @@ func (p *wlParser) Parse(parent ast.Node, block text.Reader, pc parser.Context)
 			}
 			break
 		}
+		// The link may end the line, e.g. at the end of a heading.
+		endPos = i + utf8.RuneLen(char)
 
 		if !opened {
 			switch char {
 			// Supports leading hash syntax for Neuron's Folgezettel, e.g. #[[id]]
 			case '#':
+				if openerCharCount > 0 {
+					break
+				}
 				rel = core.LinkRelationUp
 				continue
-			case '[':
+			case '[', '［':
 				openerCharCount += 1
 				continue
 			}
@@ -103,8 +143,9 @@ func (p *wlParser) Parse(parent ast.Node, block text.Reader, pc parser.Context)
 				escaping = true
 				continue
 
-			case ']':
+			case ']', '］':
 				closerCharCount += 1
+				closers += string(char)
 				if closerCharCount == openerCharCount {
 					closed = true
 					// Neuron's legacy [[[Folgezettel]]].
@@ -120,10 +161,11 @@ func (p *wlParser) Parse(parent ast.Node, block text.Reader, pc parser.Context)
 		// Found incomplete number of closing brackets to close the link.
 		// We add them to the HREF and reset the count.
 		if closerCharCount > 0 {
-			for i := 0; i < closerCharCount; i++ {
-				appendRune(']')
+			for _, c := range closers {
+				appendRune(c)
 			}
 			closerCharCount = 0
+			closers = ""
 		}
 		appendRune(char)
 	}
@@ -132,15 +174,27 @@ func (p *wlParser) Parse(parent ast.Node, block text.Reader, pc parser.Context)
 		return nil
 	}
 
+	if embed {
+		endPos++
+	}
 	block.Advance(endPos)
 
-	href = strings.TrimSpace(href)
+	if p.labelFirst && len(label) > 0 {
+		href, label = label, href
+	}
+
+	href = trimSmartQuotes(strings.TrimSpace(href))
 	label = strings.TrimSpace(label)
+	if p.tagEnabled && !embed && strings.HasPrefix(href, "#") {
+		if tag := strings.TrimSpace(href[1:]); tag != "" {
+			return &Tags{Tags: []string{tag}, Start: segment.Start}
+		}
+	}
 	if len(label) == 0 {
 		label = href
 	}
 
-	link := &WikiLink{Link: *ast.NewLink()}
+	link := &WikiLink{Link: *ast.NewLink(), Start: segment.Start, Embed: embed}
 	link.Destination = []byte(href)
 	// Title will be parsed as the link's rel by the Markdown parser.
 	link.Title = []byte(rel)
@@ -148,3 +202,146 @@ func (p *wlParser) Parse(parent ast.Node, block text.Reader, pc parser.Context)
 
 	return link
 }
+
+// fullwidthOpener is the fullwidth opening bracket of CJK input methods.
+const fullwidthOpener = "［"
+
+// wlFullwidthTransformer parses the wiki links written with fullwidth
+// brackets, e.g. ［［wiki link］］.
+//
+// The inline parsers are only triggered by ASCII punctuation and spaces, so
+// these links are left in the text nodes, e.g. in CJK text written without
+// spaces. The text nodes are split around them in place, to keep the
+// segments in the coordinates of the original source.
+type wlFullwidthTransformer struct {
+	parser *wlParser
+}
+
+func (t *wlFullwidthTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	if !bytes.Contains(source, []byte(fullwidthOpener+fullwidthOpener)) {
+		return
+	}
+
+	parents := []ast.Node{}
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n.(type) {
+		case *ast.CodeSpan, *ast.Link, *ast.Image, *ast.AutoLink, *WikiLink:
+			return ast.WalkSkipChildren, nil
+		case *ast.Text:
+			if parent := n.Parent(); len(parents) == 0 || parents[len(parents)-1] != parent {
+				parents = append(parents, parent)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, parent := range parents {
+		t.transformChildren(parent, source, pc)
+	}
+}
+
+// transformChildren parses the fullwidth wiki links found in each run of
+// contiguous text nodes of the given line.
+func (t *wlFullwidthTransformer) transformChildren(parent ast.Node, source []byte, pc parser.Context) {
+	for c := parent.FirstChild(); c != nil; {
+		first, ok := c.(*ast.Text)
+		if !ok {
+			c = c.NextSibling()
+			continue
+		}
+
+		last := first
+		for !last.SoftLineBreak() && !last.HardLineBreak() {
+			next, ok := last.NextSibling().(*ast.Text)
+			if !ok || next.Segment.Start != last.Segment.Stop {
+				break
+			}
+			last = next
+		}
+		c = last.NextSibling()
+		t.transformRun(parent, first, last, source, pc)
+	}
+}
+
+// transformRun replaces the text nodes from first to last by the wiki links
+// they contain and the text around them.
+func (t *wlFullwidthTransformer) transformRun(parent ast.Node, first *ast.Text, last *ast.Text, source []byte, pc parser.Context) {
+	start, stop := first.Segment.Start, last.Segment.Stop
+	nodes := []ast.Node{}
+	cursor := start
+	for from := start; from < stop; {
+		i := bytes.Index(source[from:stop], []byte(fullwidthOpener+fullwidthOpener))
+		if i == -1 {
+			break
+		}
+		opening := from + i
+
+		segments := text.NewSegments()
+		segments.Append(text.NewSegment(opening, stop))
+		block := text.NewBlockReader(source, segments)
+		link := t.parser.Parse(parent, block, pc)
+		if link == nil {
+			from = opening + len(fullwidthOpener)
+			continue
+		}
+
+		if opening > cursor {
+			nodes = append(nodes, ast.NewTextSegment(text.NewSegment(cursor, opening)))
+		}
+		nodes = append(nodes, link)
+		_, pos := block.Position()
+		cursor, from = pos.Start, pos.Start
+	}
+	if len(nodes) == 0 {
+		return
+	}
+
+	// The remaining text carries the line break of the run.
+	rest := ast.NewTextSegment(text.NewSegment(cursor, stop))
+	rest.SetSoftLineBreak(last.SoftLineBreak())
+	rest.SetHardLineBreak(last.HardLineBreak())
+	if cursor < stop || rest.SoftLineBreak() || rest.HardLineBreak() {
+		nodes = append(nodes, rest)
+	}
+
+	next := last.NextSibling()
+	for n := ast.Node(first); n != next; {
+		following := n.NextSibling()
+		parent.RemoveChild(parent, n)
+		n = following
+	}
+	for _, n := range nodes {
+		if next != nil {
+			parent.InsertBefore(parent, next, n)
+		} else {
+			parent.AppendChild(parent, n)
+		}
+	}
+}
+
+// smartQuotes maps the typographic opening quotes to their closing quote.
+var smartQuotes = map[rune]rune{
+	'“': '”',
+	'‘': '’',
+	'„': '“',
+	'«': '»',
+	'‹': '›',
+}
+
+// trimSmartQuotes strips a pair of typographic quotes wrapping s, as inserted
+// by word processors.
+func trimSmartQuotes(s string) string {
+	opening, size := utf8.DecodeRuneInString(s)
+	closing, ok := smartQuotes[opening]
+	if !ok || !strings.HasSuffix(s[size:], string(closing)) {
+		return s
+	}
+	if trimmed := strings.TrimSpace(strings.TrimSuffix(s[size:], string(closing))); trimmed != "" {
+		return trimmed
+	}
+	return s
+}
@@ -0,0 +1,61 @@
+package markdown
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/zk-org/zk/internal/util/opt"
+)
+
+// languageStopwords holds the most frequent function words of the languages
+// which can be detected, indexed by their ISO 639-1 code.
+var languageStopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "was", "for", "with", "as", "on", "this", "are", "be", "have", "not", "but", "by", "from", "they", "you", "which", "or", "an", "at", "his", "her", "we"},
+	"fr": {"le", "la", "les", "et", "des", "du", "un", "une", "est", "dans", "que", "qui", "pour", "pas", "sur", "au", "aux", "avec", "ce", "cette", "il", "elle", "nous", "vous", "ils", "mais", "ou", "sont", "par", "ne"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "zu", "den", "mit", "sich", "des", "auf", "für", "im", "dem", "auch", "es", "an", "als", "wir", "ich", "sie", "aber", "noch", "wie", "oder", "sind", "bei"},
+	"es": {"el", "los", "las", "y", "del", "que", "en", "un", "una", "es", "por", "con", "para", "se", "no", "lo", "su", "al", "como", "más", "pero", "sus", "le", "ya", "o", "este", "está", "son", "muy", "hay"},
+	"it": {"il", "lo", "gli", "e", "di", "che", "è", "un", "una", "per", "non", "con", "del", "della", "sono", "nel", "alla", "si", "come", "ma", "più", "anche", "questo", "dei", "delle", "le", "da", "ha", "se", "mi"},
+	"pt": {"o", "os", "as", "e", "do", "da", "que", "em", "um", "uma", "é", "para", "com", "não", "dos", "das", "se", "na", "no", "por", "mais", "como", "mas", "ao", "ele", "ela", "foi", "são", "seu", "sua"},
+}
+
+// minLanguageClues is the minimum number of stopwords required to guess the
+// language of a text.
+const minLanguageClues = 3
+
+// detectLanguage guesses the language of the given plain text by counting
+// its stopwords. The confidence is the ratio of the stopwords found which
+// belong to the guessed language.
+//
+// The language is null when the text is too short or ambiguous.
+func detectLanguage(text string) (opt.String, float64) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	scores := map[string]int{}
+	total := 0
+	for _, word := range words {
+		for lang, stopwords := range languageStopwords {
+			for _, stopword := range stopwords {
+				if word == stopword {
+					scores[lang]++
+					total++
+					break
+				}
+			}
+		}
+	}
+
+	best, bestScore, tie := "", 0, false
+	for lang, score := range scores {
+		if score > bestScore {
+			best, bestScore, tie = lang, score, false
+		} else if score == bestScore {
+			tie = true
+		}
+	}
+	if bestScore < minLanguageClues || tie {
+		return opt.NullString, 0
+	}
+	return opt.NewString(best), float64(bestScore) / float64(total)
+}
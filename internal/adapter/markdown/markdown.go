@@ -1,11 +1,20 @@
 package markdown
 
 import (
-	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"html"
 	"net/url"
+	"path"
+	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/zk-org/zk/internal/adapter/markdown/extensions"
 	"github.com/zk-org/zk/internal/core"
@@ -14,18 +23,29 @@ import (
 	strutil "github.com/zk-org/zk/internal/util/strings"
 	"github.com/zk-org/zk/internal/util/yaml"
 	"github.com/mvdan/xurls"
+	toml "github.com/pelletier/go-toml"
+	"github.com/relvacode/iso8601"
 	"github.com/yuin/goldmark"
 	meta "github.com/yuin/goldmark-meta"
 	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/extension"
+	east "github.com/yuin/goldmark/extension/ast"
 	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/text"
+	gutil "github.com/yuin/goldmark/util"
+	goyaml "gopkg.in/yaml.v2"
 )
 
+// ErrNoTitle is returned when parsing a note without any title, if the
+// RequireTitle option is enabled.
+var ErrNoTitle = errors.New("the note doesn't have a title")
+
 // Parser parses the content of Markdown notes.
 type Parser struct {
-	md     goldmark.Markdown
-	logger util.Logger
+	md           goldmark.Markdown
+	options      ParserOpts
+	mentionRegex *regexp.Regexp
+	logger       util.Logger
 }
 
 type ParserOpts struct {
@@ -35,195 +55,2308 @@ type ParserOpts struct {
 	MultiWordTagEnabled bool
 	// Indicates whether :colon:tags: are parsed.
 	ColontagEnabled bool
+	// Indicates whether wiki links are written with the label before the
+	// target, e.g. [[label | target]].
+	WikiLinkLabelFirst bool
+	// Indicates whether wiki links targeting a #tag are parsed as tags, e.g.
+	// [[#tag]].
+	WikiLinkTagEnabled bool
+	// Indicates whether Dataview's inline fields are parsed into the inline
+	// metadata, e.g. `key:: value`.
+	InlineFieldsEnabled bool
+	// Optional callback used to resolve the target of internal links while
+	// parsing, e.g. to find dangling links without a second pass.
+	LinkResolver func(target string) (resolvedID string, ok bool)
+	// Prefix of a footer line declaring the modification date of the note,
+	// e.g. `Last updated:`. The footer is ignored when empty.
+	FooterDatePrefix string
+	// Layouts used to parse the footer date, see time.Parse. Defaults to
+	// ISO 8601 dates.
+	FooterDateLayouts []string
+	// Pattern matching the keys of Pandoc citations, e.g. `@smith2020`. Any
+	// key is accepted when nil.
+	CitationKeyRegex *regexp.Regexp
+	// Indicates whether @mentions are parsed.
+	MentionEnabled bool
+	// Characters allowed in a @mention in addition to letters and digits.
+	// Defaults to `-_`.
+	MentionCharset string
+	// Custom visitors called for each node of the note AST, to extract
+	// additional data. They are called during the same traversal used to
+	// extract links and tags, so they don't require an extra pass.
+	Visitors []func(n ast.Node, entering bool, source []byte)
+	// Boolean frontmatter keys flagging a note as a Map of Content. Defaults
+	// to `moc`.
+	MOCKeys []string
+	// Indicates whether the content of inline code spans is collected as
+	// keywords, e.g. symbol names.
+	CodeKeywordsEnabled bool
+	// Indicates whether GFM tables are parsed.
+	TablesEnabled bool
+	// Indicates whether reference and inline footnotes are parsed, e.g.
+	// `[^1]` and `^[A footnote]`.
+	FootnotesEnabled bool
+	// Minimum number of characters of an inline tag, shorter tags are
+	// dropped. Defaults to 1, i.e. no filtering.
+	MinTagLength int
+	// Indicates whether numeric-only inline tags are dropped, e.g. `:1:`.
+	DropNumericTags bool
+	// Indicates whether the frontmatter keys are matched exactly as written.
+	// By default, they are lowercased.
+	CaseSensitiveKeys bool
+	// Rules used to generate the anchors of the headings. Defaults to
+	// GitHub's.
+	SlugStyle SlugStyle
+	// Frontmatter keys holding the parent note, either as a wiki link or a
+	// path. Defaults to `up` and `parent`.
+	ParentKeys []string
+	// Frontmatter keys holding the explicit slug of the note, e.g. for
+	// publishing. Defaults to `slug` and `permalink`.
+	SlugKeys []string
+	// Frontmatter keys holding the series the note belongs to, either as a
+	// string or a list. Defaults to `series`.
+	SeriesKeys []string
+	// Integer frontmatter keys holding the order of the note in its series.
+	// Defaults to `series_order`.
+	SeriesOrderKeys []string
+	// Excerpt markers ending the lead of the note, e.g. `<!--more-->`. The
+	// earliest marker found in the body wins. When none is found, the lead
+	// is the opening paragraph.
+	LeadMarkers []string
+	// Boolean frontmatter keys disabling the extraction of the heading
+	// outline when false. Defaults to `toc`.
+	TOCKeys []string
+	// Frontmatter keys holding the lead of the note, used instead of the
+	// opening paragraph. Defaults to `abstract`.
+	LeadKeys []string
+	// Integer frontmatter keys holding the explicit weight of a note, used to
+	// sort listings. Defaults to `weight` and `order`.
+	WeightKeys []string
+	// Keys of the maps holding the tag names, when the frontmatter tags are
+	// a list of maps, e.g. `tags: [{name: work}]`. Defaults to `name`.
+	TagSubKeys []string
+	// OnTag is called with each tag found while parsing a note, for example
+	// to index them on the fly. Inline tags dropped as noise are not
+	// reported. The position of the frontmatter tags is the zero Position.
+	OnTag func(tag string, pos core.Position)
+	// Indicates whether the tags are only reported to OnTag, leaving the
+	// Tags of the note content empty.
+	TagsCallbackOnly bool
+	// Indicates whether the language of the body is guessed from its
+	// stopwords, e.g. for search tokenization. This requires rendering the
+	// body as plain text, so it is disabled by default.
+	LanguageDetectionEnabled bool
+	// Frontmatter keys holding the accent color of the note, as a CSS hex or
+	// named color. Defaults to `color`.
+	ColorKeys []string
+	// Indicates whether the raw text of the top-level lists is collected,
+	// e.g. for checklist apps.
+	ListsEnabled bool
+	// Frontmatter keys holding the canonical note this note is a duplicate
+	// of, either as a wiki link or a path. Defaults to `canonical` and
+	// `redirect`.
+	CanonicalKeys []string
+	// Indicates whether the line and columns of the links are computed, e.g.
+	// to position markers in a UI.
+	LinkPositionsEnabled bool
+	// Number of columns of a tab character, used to compute the visual
+	// column of the links. Defaults to 4.
+	TabWidth int
+	// Indicates whether the YAML frontmatter is parsed as regular Markdown,
+	// e.g. for a raw parsing mode. The body is then the whole note content,
+	// and the title is found only in the headings.
+	FrontmatterDisabled bool
+	// Frontmatter keys holding the preview of the note, used instead of the
+	// first words of its body. Defaults to `description`.
+	PreviewKeys []string
+	// Number of words of the body used as the preview of the note. Defaults
+	// to 30.
+	PreviewWordCount int
+	// Names or IDs of the parsed note, e.g. its filename stem, used to
+	// detect embeds of the note itself such as `![[This Note]]`.
+	SelfTargets []string
+	// Indicates whether the lead skips the opening paragraph when it is
+	// identical to the title, e.g. a frontmatter title repeated in the body.
+	DedupeTitleLead bool
+	// Indicates whether notes without a frontmatter or heading title are
+	// rejected with ErrNoTitle.
+	RequireTitle bool
+	// Frontmatter keys declaring links with a custom relation, mapped to the
+	// name of the relation, e.g. `contradicts: "[[Note]]"`. The values are
+	// either a single link or a list, written as wiki links or paths.
+	RelationKeys map[string]string
+	// Indicates whether the ISO 8601 dates mentioned in the body are parsed,
+	// e.g. `2021-05-01`.
+	DateMentionsEnabled bool
+	// Boolean frontmatter keys flagging a note as pinned in listings.
+	// Defaults to `pinned` and `favorite`.
+	PinnedKeys []string
+	// Deepest level of the headings recorded in the outline, e.g. 3 to skip
+	// the H4 to H6. All the levels are recorded when 0.
+	MaxHeadingDepth int
+	// Frontmatter keys holding the workflow status of the note, e.g. `draft`.
+	// Defaults to `status`.
+	StatusKeys []string
+	// Allowed values of the status, compared regardless of case. Any value is
+	// accepted when nil.
+	StatusValues []string
+	// Frontmatter keys holding the name of the template the note was created
+	// from, e.g. `daily`. Defaults to `template`.
+	TemplateKeys []string
+	// Indicates whether the internal link targets are also recorded in
+	// lowercase, to be matched regardless of case.
+	LinkTargetLowercase bool
+	// Frontmatter keys holding the coordinates of the note, either as a
+	// `lat,lng` string or a `{lat, lng}` map. Defaults to `location` and
+	// `geo`.
+	GeoKeys []string
+	// Indicates whether the headings enclosing each link are recorded, e.g.
+	// for breadcrumbs in backlinks.
+	LinkHeadingPathsEnabled bool
+	// Indicates whether the wiki links of the first top-level list are
+	// recorded in order as the child links of the note, e.g. in index notes.
+	ChildLinksEnabled bool
+	// Frontmatter keys holding the creation date of the note. Defaults to
+	// `created` and `date`.
+	CreatedKeys []string
+	// Time zone of the frontmatter dates written without an offset, e.g.
+	// `2021-03-04 10:00`. Defaults to UTC.
+	TimeZone *time.Location
+	// Indicates whether a frontmatter which can't be decoded is recovered
+	// line by line, keeping the valid `key: value` pairs. The other lines
+	// are reported as warnings.
+	LenientFrontmatter bool
+	// Pattern matching a Luhmann ID at the start of the title or file name,
+	// e.g. `^[0-9]+(?:[a-z]+[0-9]*)*`. The first capture group is the ID, if
+	// any. The ID is not extracted when nil.
+	LuhmannIDRegex *regexp.Regexp
+	// Indicates whether a Luhmann ID found in the title is removed from it.
+	StripLuhmannIDFromTitle bool
+	// Frontmatter keys holding the files attached to the note, either as a
+	// string or a list. Defaults to `attachments`.
+	AttachmentKeys []string
+	// Indicates whether a warning is reported for each internal link using
+	// an absolute file path, e.g. `/Users/me/note.md`, which is not portable
+	// across machines.
+	AbsolutePathWarningsEnabled bool
+	// Frontmatter keys holding the title used to sort the note, e.g.
+	// `Great Gatsby, The`. Defaults to `title_sort` and `sort_title`.
+	SortTitleKeys []string
+	// Indicates whether a body made only of HTML comments, such as zk
+	// directives, is considered empty. The directives are still parsed.
+	SkipCommentOnlyBody bool
+	// Frontmatter keys holding the priority of the note, e.g. `high`.
+	// Defaults to `priority`.
+	PriorityKeys []string
+	// Integer frontmatter keys holding the difficulty of the note, e.g. `3`.
+	// Defaults to `difficulty`.
+	DifficultyKeys []string
+	// Frontmatter keys holding the notes linking to this one, as declared by
+	// some migration tools, e.g. `backlinks: ["[[Index]]"]`. They are not
+	// added to the outgoing links. Defaults to `backlinks`.
+	BacklinkKeys []string
+	// Frontmatter keys holding the icon displayed next to the note, e.g.
+	// `icon: 📕`. Defaults to `icon`.
+	IconKeys []string
+	// Relative dates accepted in the frontmatter, with their offset in days
+	// from the current day, e.g. `created: today`. Defaults to `today`,
+	// `yesterday` and `tomorrow`.
+	RelativeDates map[string]int
+	// Additional parsers of the frontmatter dates, tried in order after the
+	// built-in formats, the relative dates and the ISO week dates.
+	DateParsers []DateParser
+	// Returns the current time used to resolve the relative dates. Defaults
+	// to time.Now.
+	Now func() time.Time
+	// Indicates whether a warning is reported for each link of the body
+	// whose visible text is not meaningful: empty, a bare URL or one of the
+	// VagueLinkTexts. The links are still recorded.
+	LinkTextWarningsEnabled bool
+	// Link texts considered as not meaningful, matched ignoring the case.
+	// Defaults to `click here`, `here`, `link`, `this link`, `read more` and
+	// `more`.
+	VagueLinkTexts []string
+	// Indicates whether the content of blockquotes, which are usually
+	// citations, is excluded from the word counts.
+	SkipQuotesInWordCount bool
 }
 
+// DateParser converts a frontmatter date written as a string, e.g. `today`.
+// The dates without an offset are read in loc, and the relative ones are
+// resolved against now. ok is false if the value is not understood.
+type DateParser func(value string, now time.Time, loc *time.Location) (date time.Time, ok bool)
+
 // NewParser creates a new Markdown Parser.
 func NewParser(options ParserOpts, logger util.Logger) *Parser {
+	if options.SlugStyle == "" {
+		options.SlugStyle = SlugStyleGitHub
+	}
+	if options.ParentKeys == nil {
+		options.ParentKeys = []string{"up", "parent"}
+	}
+	if options.SlugKeys == nil {
+		options.SlugKeys = []string{"slug", "permalink"}
+	}
+	if options.StatusKeys == nil {
+		options.StatusKeys = []string{"status"}
+	}
+	if options.VagueLinkTexts == nil {
+		options.VagueLinkTexts = []string{"click here", "here", "link", "this link", "read more", "more"}
+	}
+	if options.RelativeDates == nil {
+		options.RelativeDates = map[string]int{"today": 0, "yesterday": -1, "tomorrow": 1}
+	}
+	if options.Now == nil {
+		options.Now = time.Now
+	}
+	if options.IconKeys == nil {
+		options.IconKeys = []string{"icon"}
+	}
+	if options.BacklinkKeys == nil {
+		options.BacklinkKeys = []string{"backlinks"}
+	}
+	if options.PriorityKeys == nil {
+		options.PriorityKeys = []string{"priority"}
+	}
+	if options.DifficultyKeys == nil {
+		options.DifficultyKeys = []string{"difficulty"}
+	}
+	if options.SortTitleKeys == nil {
+		options.SortTitleKeys = []string{"title_sort", "sort_title"}
+	}
+	if options.AttachmentKeys == nil {
+		options.AttachmentKeys = []string{"attachments"}
+	}
+	if options.CreatedKeys == nil {
+		options.CreatedKeys = []string{"created", "date"}
+	}
+	if options.TimeZone == nil {
+		options.TimeZone = time.UTC
+	}
+	if options.GeoKeys == nil {
+		options.GeoKeys = []string{"location", "geo"}
+	}
+	if options.TemplateKeys == nil {
+		options.TemplateKeys = []string{"template"}
+	}
+	if options.PinnedKeys == nil {
+		options.PinnedKeys = []string{"pinned", "favorite"}
+	}
+	if options.PreviewKeys == nil {
+		options.PreviewKeys = []string{"description"}
+	}
+	if options.PreviewWordCount <= 0 {
+		options.PreviewWordCount = 30
+	}
+	if options.TabWidth <= 0 {
+		options.TabWidth = 4
+	}
+	if options.CanonicalKeys == nil {
+		options.CanonicalKeys = []string{"canonical", "redirect"}
+	}
+	if options.ColorKeys == nil {
+		options.ColorKeys = []string{"color"}
+	}
+	if options.TagSubKeys == nil {
+		options.TagSubKeys = []string{"name"}
+	}
+	if options.SeriesKeys == nil {
+		options.SeriesKeys = []string{"series"}
+	}
+	if options.SeriesOrderKeys == nil {
+		options.SeriesOrderKeys = []string{"series_order"}
+	}
+	if options.TOCKeys == nil {
+		options.TOCKeys = []string{"toc"}
+	}
+	if options.LeadKeys == nil {
+		options.LeadKeys = []string{"abstract"}
+	}
+	if options.WeightKeys == nil {
+		options.WeightKeys = []string{"weight", "order"}
+	}
+	if options.MentionCharset == "" {
+		options.MentionCharset = "-_"
+	}
+	if options.MOCKeys == nil {
+		options.MOCKeys = []string{"moc"}
+	}
+
+	exts := []goldmark.Extender{
+		extension.NewLinkify(
+			extension.WithLinkifyAllowedProtocols([][]byte{
+				[]byte("http:"),
+				[]byte("https:"),
+			}),
+			extension.WithLinkifyURLRegexp(
+				xurls.Strict,
+			),
+		),
+		&extensions.WikiLinkExt{
+			LabelFirst: options.WikiLinkLabelFirst,
+			TagEnabled: options.WikiLinkTagEnabled,
+		},
+		&extensions.TagExt{
+			HashtagEnabled:      options.HashtagEnabled,
+			MultiWordTagEnabled: options.MultiWordTagEnabled,
+			ColontagEnabled:     options.ColontagEnabled,
+		},
+	}
+	if !options.FrontmatterDisabled {
+		exts = append(exts, meta.Meta)
+	}
+	if options.TablesEnabled {
+		exts = append(exts, extension.Table)
+	}
+	if options.FootnotesEnabled {
+		exts = append(exts, extension.Footnote, &extensions.InlineFootnoteExt{})
+	}
+
 	return &Parser{
 		md: goldmark.New(
-			goldmark.WithExtensions(
-				meta.Meta,
-				extension.NewLinkify(
-					extension.WithLinkifyAllowedProtocols([][]byte{
-						[]byte("http:"),
-						[]byte("https:"),
-					}),
-					extension.WithLinkifyURLRegexp(
-						xurls.Strict,
-					),
-				),
-				extensions.WikiLinkExt,
-				&extensions.TagExt{
-					HashtagEnabled:      options.HashtagEnabled,
-					MultiWordTagEnabled: options.MultiWordTagEnabled,
-					ColontagEnabled:     options.ColontagEnabled,
-				},
-			),
+			goldmark.WithExtensions(exts...),
 		),
-		logger: logger,
+		options:      options,
+		mentionRegex: newMentionRegex(options.MentionCharset),
+		logger:       logger,
 	}
 }
 
 // ParseNoteContent implements core.NoteContentParser.
+//
+// The parsing never writes into the source of the note, so the same buffer
+// can be shared across concurrent parses.
 func (p *Parser) ParseNoteContent(content string) (*core.NoteContent, error) {
-	bytes := []byte(content)
+	return p.parseNoteContentWithContext(content, parser.NewContext())
+}
+
+// parseNoteContentWithContext parses the given note content with a blank
+// parser context, e.g. reused from a pool.
+func (p *Parser) parseNoteContentWithContext(content string, context parser.Context) (*core.NoteContent, error) {
+	bytes, fence := p.prepareSource(content)
 
-	context := parser.NewContext()
 	root := p.md.Parser().Parse(
 		text.NewReader(bytes),
 		parser.WithContext(context),
 	)
 
-	links, err := p.parseLinks(root, bytes)
+	elements, err := p.walkAST(root, bytes)
 	if err != nil {
 		return nil, err
 	}
 
-	frontmatter, err := parseFrontmatter(context, bytes)
+	warnings := []string{}
+
+	frontmatter, err := parseFrontmatter(context, bytes, fence, p.options.CaseSensitiveKeys, p.options.LenientFrontmatter)
+	if err != nil {
+		return nil, err
+	}
+	if frontmatter.unterminated {
+		warnings = append(warnings, "the frontmatter closing fence is missing")
+	}
+	for _, line := range frontmatter.unrecovered {
+		warnings = append(warnings, fmt.Sprintf("the frontmatter line %q can't be decoded", line))
+	}
+	undefinedRefs, err := parseUndefinedReferences(root, bytes, context)
 	if err != nil {
 		return nil, err
 	}
+	for _, ref := range undefinedRefs {
+		warnings = append(warnings, fmt.Sprintf("the link reference %q is not defined", ref))
+	}
+	if hasUnclosedCodeFence(root, bytes) {
+		// The rest of the note is parsed as code, so no links or tags are
+		// extracted from it.
+		warnings = append(warnings, "the closing fence of a code block is missing")
+	}
 
-	title, bodyStart, err := parseTitle(frontmatter, root, bytes)
+	title, rawTitle, bodyStart, err := parseTitle(frontmatter, root, bytes)
 	if err != nil {
 		return nil, err
 	}
+	if title.IsNull() && p.options.RequireTitle {
+		return nil, ErrNoTitle
+	}
+	if p.options.FrontmatterDisabled {
+		// The whole note is the body, including its title.
+		bodyStart = 0
+	}
 	body := parseBody(bodyStart, bytes)
+	commentOnly := p.options.SkipCommentOnlyBody && isCommentOnly(body.Unwrap())
+	if commentOnly {
+		body = opt.NullString
+	}
+
+	tags := []string{}
+	if p.options.OnTag == nil || !p.options.TagsCallbackOnly {
+		tags = parseTags(frontmatter, p.options.TagSubKeys, p.filterInlineTags(elements.tags))
+	}
+	if p.options.OnTag != nil {
+		p.reportTags(frontmatter, elements, bytes)
+	}
+
+	created := frontmatter.getTime(p.parseDate, p.options.CreatedKeys...)
+	createdUTC := time.Time{}
+	if !created.IsZero() {
+		createdUTC = created.UTC()
+	} else if key, val, ok := frontmatter.getValue(p.options.CreatedKeys...); ok {
+		warnings = append(warnings, fmt.Sprintf("the %s %q is not a valid date", key, fmt.Sprint(val)))
+	}
+
+	modifiedKeys := []string{"modified", "updated"}
+	modified := frontmatter.getTime(p.parseDate, modifiedKeys...)
+	if modified.IsZero() {
+		if key, val, ok := frontmatter.getValue(modifiedKeys...); ok {
+			warnings = append(warnings, fmt.Sprintf("the %s %q is not a valid date", key, fmt.Sprint(val)))
+		}
+	}
+	if modified.IsZero() && p.options.FooterDatePrefix != "" {
+		var ok bool
+		modified, ok = p.parseFooterDate(body)
+		if !ok {
+			warnings = append(warnings, "the footer date can't be parsed")
+		}
+	}
+
+	citations, err := p.parseCitations(root, bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	dateMentions := []time.Time{}
+	var earliestDate, latestDate time.Time
+	if p.options.DateMentionsEnabled {
+		dateMentions, err = parseDateMentions(root, bytes)
+		if err != nil {
+			return nil, err
+		}
+		for _, date := range dateMentions {
+			if earliestDate.IsZero() || date.Before(earliestDate) {
+				earliestDate = date
+			}
+			if date.After(latestDate) {
+				latestDate = date
+			}
+		}
+	}
+
+	mentions := []string{}
+	if p.options.MentionEnabled {
+		mentions, err = p.parseMentions(root, bytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	inlineMetadata := map[string][]string{}
+	if p.options.InlineFieldsEnabled {
+		inlineMetadata, err = parseInlineFields(root, bytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The links are sorted in document order, starting with the ones
+	// declared in the frontmatter.
+	links := []core.Link{}
+	parent, parentLink := p.parseFrontmatterLink(frontmatter, p.options.ParentKeys, core.LinkRelationParent)
+	if parentLink != nil {
+		links = append(links, *parentLink)
+	}
+	canonical, canonicalLink := p.parseFrontmatterLink(frontmatter, p.options.CanonicalKeys, core.LinkRelationCanonical)
+	if canonicalLink != nil {
+		links = append(links, *canonicalLink)
+	}
+	links = append(links, p.parseRelationLinks(frontmatter)...)
+	links = append(links, elements.links...)
+
+	if p.options.AbsolutePathWarningsEnabled {
+		reported := map[string]bool{}
+		for _, link := range links {
+			if !link.IsExternal && isAbsolutePath(link.Href) && !reported[link.Href] {
+				reported[link.Href] = true
+				warnings = append(warnings, fmt.Sprintf("the link %q uses an absolute path", link.Href))
+			}
+		}
+	}
+
+	if p.options.LinkTextWarningsEnabled {
+		for _, link := range elements.links {
+			if warning, ok := p.checkLinkText(link); ok && !strutil.Contains(warnings, warning) {
+				warnings = append(warnings, warning)
+			}
+		}
+	}
+
+	// A lead declared in the frontmatter is not part of the body.
+	lead := frontmatter.getString(p.options.LeadKeys...)
+	rest := body
+	if lead.IsNull() && !commentOnly {
+		if marker, ok := p.findLeadMarker(root, bytes, bodyStart); ok {
+			lead = opt.NewNotEmptyString(strings.TrimSpace(string(bytes[bodyStart:marker.start])))
+			rest = opt.NewNotEmptyString(strings.TrimSpace(string(bytes[marker.end:])))
+		} else {
+			leadStart := bodyStart
+			if p.options.DedupeTitleLead {
+				leadStart = p.skipTitleLead(root, bodyStart, bytes, title)
+			}
+			lead = parseLead(root, leadStart, bytes)
+			rest = parseRest(root, leadStart, bytes)
+		}
+	} else if !lead.IsNull() {
+		lead = opt.NewString(strings.TrimSpace(lead.Unwrap()))
+	}
+
+	headings := elements.headings
+	if !frontmatter.getBool(p.options.TOCKeys...).OrBool(true).Unwrap() {
+		headings = []core.Heading{}
+	} else if p.options.MaxHeadingDepth > 0 {
+		headings = []core.Heading{}
+		for _, heading := range elements.headings {
+			if heading.Level <= p.options.MaxHeadingDepth {
+				headings = append(headings, heading)
+			}
+		}
+	}
+
+	seriesList := p.parseSeries(frontmatter)
+	series := opt.NullString
+	if len(seriesList) > 0 {
+		series = opt.NewString(seriesList[0])
+	}
+
+	// An unknown status is kept as is, to not lose data.
+	status := frontmatter.getString(p.options.StatusKeys...)
+	if !status.IsNull() {
+		status = opt.NewString(strings.TrimSpace(status.Unwrap()))
+		if !p.isAllowedStatus(status.Unwrap()) {
+			warnings = append(warnings, fmt.Sprintf("the status %q is not one of: %s", status.Unwrap(), strings.Join(p.options.StatusValues, ", ")))
+		}
+	}
+
+	preview := frontmatter.getString(p.options.PreviewKeys...)
+	if preview.IsNull() {
+		words := strings.Fields(plainBody(root, bytes, bodyStart, PlainOpts{}))
+		if len(words) > p.options.PreviewWordCount {
+			words = words[:p.options.PreviewWordCount]
+		}
+		preview = opt.NewNotEmptyString(strings.Join(words, " "))
+	} else {
+		preview = opt.NewString(strings.TrimSpace(preview.Unwrap()))
+	}
+
+	// An invalid color is kept as is, in case the UI understands it.
+	color := frontmatter.getString(p.options.ColorKeys...)
+	if !color.IsNull() && !isValidColor(strings.TrimSpace(color.Unwrap())) {
+		warnings = append(warnings, fmt.Sprintf("the color %q is not a valid CSS color", color.Unwrap()))
+	}
+
+	geo, err := parseGeo(frontmatter, p.options.GeoKeys)
+	if err != nil {
+		warnings = append(warnings, err.Error())
+	}
+
+	luhmannID := opt.NullString
+	if id, rest, ok := p.splitLuhmannID(title.Unwrap()); ok {
+		luhmannID = opt.NewString(id)
+		if p.options.StripLuhmannIDFromTitle {
+			title = opt.NewNotEmptyString(rest)
+		}
+	}
+
+	priority := frontmatter.getString(p.options.PriorityKeys...)
+	if priority.IsNull() {
+		if key, val, ok := frontmatter.getValue(p.options.PriorityKeys...); ok {
+			warnings = append(warnings, fmt.Sprintf("the %s %q is not a string", key, fmt.Sprint(val)))
+		}
+	} else {
+		priority = opt.NewString(strings.TrimSpace(priority.Unwrap()))
+	}
+	difficulty := frontmatter.getInt(p.options.DifficultyKeys...)
+	if difficulty.IsNull() {
+		if key, val, ok := frontmatter.getValue(p.options.DifficultyKeys...); ok {
+			warnings = append(warnings, fmt.Sprintf("the %s %q is not an integer", key, fmt.Sprint(val)))
+		}
+	}
+
+	sortTitle := frontmatter.getString(p.options.SortTitleKeys...)
+	if sortTitle.IsNull() {
+		sortTitle = title
+	} else {
+		sortTitle = opt.NewString(strings.TrimSpace(sortTitle.Unwrap()))
+	}
+
+	detectedLang, detectedLangConfidence := opt.NullString, 0.0
+	if p.options.LanguageDetectionEnabled {
+		detectedLang, detectedLangConfidence = detectLanguage(plainBody(root, bytes, bodyStart, PlainOpts{KeepHeadings: true}))
+	}
+
+	parsed := &core.NoteContent{
+		Title:                  title,
+		SortTitle:              sortTitle,
+		LuhmannID:              luhmannID,
+		RawTitle:               rawTitle,
+		Body:                   body,
+		Lead:                   lead,
+		Preview:                preview,
+		Rest:                   rest,
+		Sections:               parseSections(root, bodyStart, bytes),
+		Headings:               headings,
+		Anchors:                elements.anchors,
+		BodyTitle:              parseBodyTitle(elements.headings),
+		Links:                  links,
+		ChildLinks:             elements.childLinks,
+		Parent:                 parent,
+		Canonical:              canonical,
+		Tags:                   tags,
+		Keywords:               parseKeywords(frontmatter),
+		Citations:              citations,
+		Mentions:               mentions,
+		DateMentions:           dateMentions,
+		EarliestDate:           earliestDate,
+		LatestDate:             latestDate,
+		Metadata:               frontmatter.values,
+		FrontmatterFormat:      frontmatter.format,
+		Visibility:             parseVisibility(frontmatter),
+		IsMOC:                  p.parseIsMOC(frontmatter),
+		Status:                 status,
+		Priority:               priority,
+		Difficulty:             difficulty,
+		IsPinned:               frontmatter.getBool(p.options.PinnedKeys...).OrBool(false).Unwrap(),
+		Slug:                   frontmatter.getString(p.options.SlugKeys...),
+		Template:               frontmatter.getString(p.options.TemplateKeys...),
+		Weight:                 frontmatter.getInt(p.options.WeightKeys...),
+		Series:                 series,
+		SeriesList:             seriesList,
+		SeriesOrder:            frontmatter.getInt(p.options.SeriesOrderKeys...),
+		Created:                created,
+		CreatedUTC:             createdUTC,
+		Modified:               modified,
+		InlineMetadata:         inlineMetadata,
+		CodeKeywords:           elements.codeKeywords,
+		NoIndex:                strutil.Contains(elements.directives, "noindex"),
+		Tables:                 elements.tables,
+		Lists:                  elements.lists,
+		Images:                 elements.images,
+		Attachments:            p.parseAttachments(frontmatter),
+		DeclaredBacklinks:      p.parseDeclaredBacklinks(frontmatter),
+		HasSelfEmbed:           elements.hasSelfEmbed,
+		Footnotes:              elements.footnotes,
+		Callouts:               elements.callouts,
+		Stats:                  elements.stats,
+		Color:                  color,
+		CSSClasses:             parseCSSClasses(frontmatter),
+		Icon:                   frontmatter.getString(p.options.IconKeys...),
+		Geo:                    geo,
+		DetectedLang:           detectedLang,
+		DetectedLangConfidence: detectedLangConfidence,
+		Warnings:               warnings,
+	}
+	// Must be done last, after reading all the frontmatter keys.
+	parsed.ConsumedKeys = frontmatter.consumedKeys()
+
+	return parsed, nil
+}
+
+// ParseNoteContentAt implements core.NoteContentParser.
+//
+// It parses the given note content like ParseNoteContent, using its file
+// path to complete the fields which can be derived from the file name, such
+// as the Luhmann ID.
+func (p *Parser) ParseNoteContentAt(filePath string, content string) (*core.NoteContent, error) {
+	parsed, err := p.ParseNoteContent(content)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.LuhmannID.IsNull() {
+		filename := path.Base(filepath.ToSlash(filePath))
+		filename = strings.TrimSuffix(filename, path.Ext(filename))
+		if id, _, ok := p.splitLuhmannID(filename); ok {
+			parsed.LuhmannID = opt.NewString(id)
+		}
+	}
+	return parsed, nil
+}
+
+// splitLuhmannID splits a Luhmann ID from the start of the given string,
+// returning the rest without its leading separators.
+func (p *Parser) splitLuhmannID(s string) (id string, rest string, ok bool) {
+	if p.options.LuhmannIDRegex == nil {
+		return "", s, false
+	}
+	match := p.options.LuhmannIDRegex.FindStringSubmatchIndex(s)
+	if match == nil || match[0] != 0 || match[1] == 0 {
+		return "", s, false
+	}
+	id = s[match[0]:match[1]]
+	if len(match) >= 4 && match[2] != -1 {
+		id = s[match[2]:match[3]]
+	}
+	rest = strings.TrimLeft(s[match[1]:], " \t-_:.")
+	return id, rest, id != ""
+}
+
+// ParseTags returns the tags of the given note content, as found by
+// ParseNoteContent. It is faster as only the frontmatter and inline tags are
+// extracted.
+func (p *Parser) ParseTags(content string) ([]string, error) {
+	source, fence := p.prepareSource(content)
 
-	tags, err := parseTags(frontmatter, root, bytes)
+	context := parser.NewContext()
+	root := p.md.Parser().Parse(
+		text.NewReader(source),
+		parser.WithContext(context),
+	)
+
+	frontmatter, err := parseFrontmatter(context, source, fence, p.options.CaseSensitiveKeys, p.options.LenientFrontmatter)
+	if err != nil {
+		return nil, err
+	}
+
+	inlineTags := make([]string, 0)
+	err = ast.Walk(root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if tags, ok := n.(*extensions.Tags); ok && entering {
+			inlineTags = append(inlineTags, tags.Tags...)
+		}
+		return ast.WalkContinue, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return &core.NoteContent{
-		Title:    title,
-		Body:     body,
-		Lead:     parseLead(body),
-		Links:    links,
-		Tags:     tags,
-		Metadata: frontmatter.values,
-	}, nil
+	return parseTags(frontmatter, p.options.TagSubKeys, p.filterInlineTags(inlineTags)), nil
+}
+
+// WalkInline parses the given note content and calls fn with each inline
+// node of the AST, e.g. texts, code spans, links and emphasis. The walk stops
+// as soon as fn returns false.
+//
+// The segments of the nodes are offsets in the given source.
+func (p *Parser) WalkInline(source string, fn func(n ast.Node) bool) error {
+	bytes, _ := p.prepareSource(source)
+	root := p.md.Parser().Parse(text.NewReader(bytes))
+
+	return ast.Walk(root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering || n.Type() != ast.TypeInline {
+			return ast.WalkContinue, nil
+		}
+		if !fn(n) {
+			return ast.WalkStop, nil
+		}
+		return ast.WalkContinue, nil
+	})
 }
 
 // parseTitle extracts the note title with its node.
-func parseTitle(frontmatter frontmatter, root ast.Node, source []byte) (title opt.String, bodyStart int, err error) {
+//
+// The title is the first heading of the lowest level, unless the frontmatter
+// forces its level, e.g. `title_heading: 2`.
+func parseTitle(frontmatter frontmatter, root ast.Node, source []byte) (title opt.String, rawTitle opt.String, bodyStart int, err error) {
 	if title = frontmatter.getString("title", "Title"); !title.IsNull() {
+		rawTitle = title
 		bodyStart = frontmatter.end
 		return
 	}
 
 	var titleNode *ast.Heading
+	if level := frontmatter.getInt("title_heading").Unwrap(); level >= 1 && level <= 6 {
+		titleNode, err = findTitleHeading(root, source, level)
+	}
+	if titleNode == nil && err == nil {
+		titleNode, err = findTitleHeading(root, source, 0)
+	}
+	if err != nil {
+		return
+	}
+
+	if titleNode != nil {
+		title = opt.NewNotEmptyString(headingText(titleNode, source))
+		rawTitle = opt.NewNotEmptyString(rawHeadingText(titleNode, source))
+		bodyStart = headingEnd(titleNode, source)
+	}
+	return
+}
+
+// findTitleHeading returns the first heading of the given level, or of the
+// lowest level found when 0.
+func findTitleHeading(root ast.Node, source []byte, level int) (titleNode *ast.Heading, err error) {
 	err = ast.Walk(root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
-		if heading, ok := n.(*ast.Heading); ok && entering &&
-			(titleNode == nil || heading.Level < titleNode.Level) {
+		heading, ok := n.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		if level != 0 && heading.Level != level {
+			return ast.WalkContinue, nil
+		}
+		if titleNode != nil && heading.Level >= titleNode.Level {
+			return ast.WalkContinue, nil
+		}
 
-			titleNode = heading
-			if heading.Level == 1 {
-				return ast.WalkStop, nil
-			}
+		// Empty headings, e.g. from a template, can't be a title.
+		if strings.TrimSpace(headingText(heading, source)) == "" {
+			return ast.WalkContinue, nil
 		}
 
+		titleNode = heading
+		if heading.Level == 1 || level != 0 {
+			return ast.WalkStop, nil
+		}
 		return ast.WalkContinue, nil
 	})
-	if err != nil {
-		return
+	return
+}
+
+// rawHeadingText returns the Markdown source of the text of a heading,
+// without its opening and closing sequences. The lines of a multi-line setext
+// heading are joined with a space.
+func rawHeadingText(heading *ast.Heading, source []byte) string {
+	lines := heading.Lines()
+	parts := make([]string, 0, lines.Len())
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		parts = append(parts, strings.TrimSpace(string(line.Value(source))))
 	}
+	return strings.Join(parts, " ")
+}
 
-	if titleNode != nil {
-		title = opt.NewNotEmptyString(string(titleNode.Text(source)))
+// headingText returns the text of a heading. Unlike ast.Node.Text, the lines
+// of a multi-line setext heading are joined with a space.
+func headingText(n ast.Node, source []byte) string {
+	var buf strings.Builder
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch {
+		case c.Kind() == ast.KindText:
+			text := c.(*ast.Text)
+			buf.Write(text.Segment.Value(source))
+			if text.SoftLineBreak() || text.HardLineBreak() {
+				buf.WriteString(" ")
+			}
+		case c.HasChildren():
+			buf.WriteString(headingText(c, source))
+		default:
+			buf.Write(c.Text(source))
+		}
+	}
+	return buf.String()
+}
 
-		if lines := titleNode.Lines(); lines.Len() > 0 {
-			bodyStart = lines.At(lines.Len() - 1).Stop
+// setextUnderlineRegex matches the underline of a setext heading.
+var setextUnderlineRegex = regexp.MustCompile(`^ {0,3}(?:=+|-+)[ \t]*\r?$`)
+
+// headingEnd returns the offset of the end of a heading in the source,
+// including the underline of a setext heading and the closing sequence of
+// an ATX heading.
+func headingEnd(heading *ast.Heading, source []byte) int {
+	lines := heading.Lines()
+	if lines.Len() == 0 {
+		return 0
+	}
+
+	lineEnd := func(offset int) int {
+		if i := bytes.IndexByte(source[offset:], '\n'); i != -1 {
+			return offset + i
 		}
+		return len(source)
 	}
-	return
+	end := lineEnd(lines.At(lines.Len() - 1).Stop)
+
+	// The content of an ATX heading is preceded by its opening sequence on
+	// the same line, e.g. `# `.
+	start := lines.At(0).Start
+	lineStart := bytes.LastIndexByte(source[:start], '\n') + 1
+	if bytes.ContainsRune(source[lineStart:start], '#') || end == len(source) {
+		return end
+	}
+
+	next := end + 1
+	if underlineEnd := lineEnd(next); setextUnderlineRegex.Match(source[next:underlineEnd]) {
+		return underlineEnd
+	}
+	return end
+}
+
+// parseBodyTitle returns the text of the first level 1 heading, whatever the
+// resolved title of the note is.
+func parseBodyTitle(headings []core.Heading) opt.String {
+	for _, heading := range headings {
+		if heading.Level == 1 {
+			return opt.NewNotEmptyString(heading.Text)
+		}
+	}
+	return opt.NullString
 }
 
 // parseBody extracts the whole content after the title.
+//
+// The source is trimmed before being converted, to copy only the body.
 func parseBody(startIndex int, source []byte) opt.String {
-	return opt.NewNotEmptyString(
-		strings.TrimSpace(
-			string(source[startIndex:]),
-		),
-	)
+	body := bytes.TrimSpace(source[startIndex:])
+	if len(body) == 0 {
+		return opt.NullString
+	}
+	return opt.NewString(string(body))
 }
 
-// parseLead extracts the body content until the first blank line.
-func parseLead(body opt.String) opt.String {
-	lead := ""
-	scanner := bufio.NewScanner(strings.NewReader(body.String()))
-	for scanner.Scan() {
-		if strings.TrimSpace(scanner.Text()) == "" {
-			break
-		}
-		lead += scanner.Text() + "\n"
-	}
+// htmlCommentRegex matches an HTML comment, e.g. `<!-- zk:noindex -->`.
+var htmlCommentRegex = regexp.MustCompile(`(?s)<!--.*?-->`)
 
-	return opt.NewNotEmptyString(strings.TrimSpace(lead))
+// isCommentOnly returns whether the given body holds only HTML comments.
+func isCommentOnly(body string) bool {
+	return body != "" && strings.TrimSpace(htmlCommentRegex.ReplaceAllString(body, "")) == ""
 }
 
-// parseTags extracts tags as #hashtags, :colon:tags: or from the YAML frontmatter.
-func parseTags(frontmatter frontmatter, root ast.Node, source []byte) ([]string, error) {
-	tags := make([]string, 0)
+// leadMarker is the position of an excerpt marker in the note.
+type leadMarker struct {
+	start int
+	end   int
+}
 
-	// Parse from YAML frontmatter, either:
-	// * a list of strings
-	// * a single space-separated string
-	findFMTags := func(key string) []string {
-		if tags, ok := frontmatter.getStrings(key); ok {
-			return tags
+// findLeadMarker returns the position of the earliest excerpt marker found
+// in the body.
+//
+// Only the top-level paragraphs and HTML blocks are searched, outside of any
+// code span, so a marker quoted in code doesn't split it.
+func (p *Parser) findLeadMarker(root ast.Node, source []byte, bodyStart int) (leadMarker, bool) {
+	for n := root.FirstChild(); n != nil; n = n.NextSibling() {
+		if n.Kind() != ast.KindParagraph && n.Kind() != ast.KindHTMLBlock {
+			continue
+		}
+		start, end, ok := blockRange(n)
+		if !ok || end <= bodyStart {
+			continue
+		}
+		if start < bodyStart {
+			start = bodyStart
+		}
 
-		} else if tags := frontmatter.getString(key); !tags.IsNull() {
-			// Parse a space-separated string list
-			res := []string{}
-			for _, s := range strings.Fields(tags.Unwrap()) {
-				s = strings.TrimSpace(s)
-				if len(s) > 0 {
-					res = append(res, s)
+		codeSpans := codeSpanSegments(n)
+		inCode := func(start int, end int) bool {
+			for _, code := range codeSpans {
+				if start < code.Stop && end > code.Start {
+					return true
 				}
 			}
-			return res
+			return false
+		}
 
-		} else {
-			return []string{}
+		var res leadMarker
+		found := false
+		for _, marker := range p.options.LeadMarkers {
+			if marker == "" {
+				continue
+			}
+			for from := start; from < end; {
+				i := bytes.Index(source[from:end], []byte(marker))
+				if i == -1 {
+					break
+				}
+				markerStart := from + i
+				markerEnd := markerStart + len(marker)
+				if inCode(markerStart, markerEnd) {
+					from = markerEnd
+					continue
+				}
+				if !found || markerStart < res.start {
+					res = leadMarker{start: markerStart, end: markerEnd}
+					found = true
+				}
+				break
+			}
+		}
+		if found {
+			return res, true
 		}
 	}
+	return leadMarker{}, false
+}
 
-	for _, key := range []string{"tag", "tags", "keyword", "keywords"} {
-		for _, t := range findFMTags(key) {
-			// Trims any # prefix to support hashtags embedded in YAML
-			// frontmatter, as in Simple Markdown Zettelkasten:
-			// http://evantravers.com/articles/2020/11/23/zettelkasten-updates/
-			tags = append(tags, strings.TrimPrefix(t, "#"))
-		}
+// parseLead extracts the body content until the first blank line.
+//
+// The top-level blocks of the AST are used instead of scanning the body line
+// by line, so a block containing blank lines (e.g. a fenced code block) is
+// kept whole.
+func parseLead(root ast.Node, bodyStart int, source []byte) opt.String {
+	start, end, ok := leadRange(root, bodyStart, source)
+	if !ok {
+		return opt.NullString
 	}
+	return opt.NewNotEmptyString(strings.TrimSpace(string(source[start:end])))
+}
 
-	// Parse #hashtags and :colon:tags:
-	err := ast.Walk(root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
-		if tagsNode, ok := n.(*extensions.Tags); ok && entering {
-			for _, tag := range tagsNode.Tags {
-				tags = append(tags, tag)
+// skipTitleLead returns the offset following the opening paragraph of the
+// body when its text is identical to the title, to avoid a redundant lead.
+func (p *Parser) skipTitleLead(root ast.Node, bodyStart int, source []byte, title opt.String) int {
+	start, end, ok := leadRange(root, bodyStart, source)
+	if !ok || title.IsNull() {
+		return bodyStart
+	}
+	if p.plainText(source[start:end]) == title.Unwrap() {
+		return end
+	}
+	return bodyStart
+}
+
+// parseRest extracts the body content following the lead.
+func parseRest(root ast.Node, bodyStart int, source []byte) opt.String {
+	_, end, ok := leadRange(root, bodyStart, source)
+	if !ok {
+		return opt.NullString
+	}
+	return opt.NewNotEmptyString(strings.TrimSpace(string(source[end:])))
+}
+
+// leadRange returns the byte offsets of the lead in the source.
+func leadRange(root ast.Node, bodyStart int, source []byte) (start int, end int, ok bool) {
+	start = -1
+	prevEnd := 0
+	for n := root.FirstChild(); n != nil; n = n.NextSibling() {
+		_, blockEnd, hasLines := blockRange(n)
+		cut := false
+		if hasLines {
+			blockEnd, cut = leadBlockEnd(n, source)
+		} else {
+			// Blocks without lines, such as thematic breaks, span the
+			// first non-blank line before the next block.
+			var lineStart int
+			lineStart, blockEnd, hasLines = lineLessBlockRange(n, prevEnd, bodyStart, source)
+			if !hasLines {
+				continue
+			}
+			if lineStart < bodyStart {
+				prevEnd = blockEnd
+				continue
+			}
+		}
+		if blockEnd <= bodyStart {
+			prevEnd = blockEnd
+			continue
+		}
+		if start == -1 {
+			start = bodyStart
+			if prevEnd > start {
+				start = prevEnd
+			}
+		} else if n.HasBlankPreviousLines() {
+			break
+		}
+		end = blockEnd
+		if cut {
+			break
+		}
+	}
+	if start == -1 {
+		return 0, 0, false
+	}
+	end = nextBlankLine(source, end)
+	return start, end, true
+}
+
+// leadBlockEnd returns the end offset of the part of the block n belonging
+// to the lead. Lists stop before the first item separated by a blank line
+// and indented code blocks at their first blank line, like the paragraphs
+// around them. cut is true when the block doesn't fit in the lead entirely.
+func leadBlockEnd(n ast.Node, source []byte) (end int, cut bool) {
+	switch n.Kind() {
+	case ast.KindList, ast.KindListItem:
+		for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+			if end > 0 && c.HasBlankPreviousLines() {
+				return end, true
+			}
+			_, _, hasLines := blockRange(c)
+			if !hasLines {
+				continue
+			}
+			childEnd, childCut := leadBlockEnd(c, source)
+			if childEnd > end {
+				end = childEnd
+			}
+			if childCut {
+				return end, true
+			}
+		}
+		return end, false
+
+	case ast.KindCodeBlock:
+		lines := n.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			line := lines.At(i)
+			if len(bytes.TrimSpace(line.Value(source))) == 0 {
+				return end, true
+			}
+			end = line.Stop
+		}
+		return end, false
+
+	default:
+		_, end, _ = blockRange(n)
+		return end, false
+	}
+}
+
+// lineLessBlockRange returns the offsets of the source line holding the
+// block n, which doesn't record any line in the AST. The line is the first
+// non-blank one after prevEnd, or after bodyStart when the block is
+// followed by the body.
+func lineLessBlockRange(n ast.Node, prevEnd int, bodyStart int, source []byte) (start int, end int, ok bool) {
+	nextStart := len(source)
+	for next := n.NextSibling(); next != nil; next = next.NextSibling() {
+		if s, _, hasLines := blockRange(next); hasLines {
+			nextStart = s
+			break
+		}
+	}
+	offset := prevEnd
+	if nextStart > bodyStart && offset < bodyStart {
+		offset = bodyStart
+	}
+	for offset < nextStart {
+		lineEnd := len(source)
+		if i := bytes.IndexByte(source[offset:], '\n'); i != -1 {
+			lineEnd = offset + i + 1
+		}
+		if len(bytes.TrimSpace(source[offset:lineEnd])) > 0 {
+			return offset, lineEnd, true
+		}
+		offset = lineEnd
+	}
+	return 0, 0, false
+}
+
+// hasUnclosedCodeFence returns whether the note ends with a fenced code block
+// missing its closing fence, which swallows the rest of the note.
+func hasUnclosedCodeFence(root ast.Node, source []byte) bool {
+	last := root.LastChild()
+	// The footnote definitions are moved to the end of the note.
+	if last != nil && last.Kind() == east.KindFootnoteList {
+		last = last.PreviousSibling()
+	}
+	block, ok := last.(*ast.FencedCodeBlock)
+	if !ok {
+		return false
+	}
+
+	// Any line following the content of the block is its closing fence.
+	if lines := block.Lines(); lines.Len() > 0 {
+		return len(bytes.TrimSpace(source[lines.At(lines.Len()-1).Stop:])) == 0
+	}
+
+	// The block is empty, so the note ends either with the opening fence
+	// or with both fences.
+	lines := strings.Split(strings.TrimRightFunc(string(source), unicode.IsSpace), "\n")
+	if len(lines) < 2 {
+		return true
+	}
+	return !codeFenceRegex.MatchString(lines[len(lines)-2])
+}
+
+// codeFenceRegex matches the opening or closing fence of a code block.
+var codeFenceRegex = regexp.MustCompile(`^ {0,3}(?:` + "`{3,}[^`]*" + `|~{3,}.*)$`)
+
+// thematicBreakRegex matches a thematic break line, e.g. `---` or `* * *`.
+var thematicBreakRegex = regexp.MustCompile(`(?m)^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})\r?$`)
+
+// parseSections splits the body of the note on its top-level thematic
+// breaks.
+func parseSections(root ast.Node, bodyStart int, source []byte) []core.Section {
+	sections := []core.Section{}
+	start := bodyStart
+	prevEnd := 0
+
+	addSection := func(end int) {
+		text := strings.TrimRightFunc(string(source[start:end]), unicode.IsSpace)
+		trimmed := strings.TrimLeftFunc(text, unicode.IsSpace)
+		if trimmed == "" {
+			return
+		}
+		sectionStart := start + len(text) - len(trimmed)
+		sections = append(sections, core.Section{
+			Text:  trimmed,
+			Start: sectionStart,
+			End:   sectionStart + len(trimmed),
+		})
+	}
+
+	for n := root.FirstChild(); n != nil; n = n.NextSibling() {
+		if n.Kind() != ast.KindThematicBreak {
+			if _, end, ok := blockRange(n); ok {
+				prevEnd = end
+			}
+			continue
+		}
+
+		// Skips the thematic breaks preceding the title.
+		if next := nextBlockRange(n); next != -1 && next <= bodyStart {
+			continue
+		}
+
+		// The thematic break nodes don't hold any position, so we look for
+		// the first thematic break line after the previous block.
+		from := start
+		if prevEnd > from {
+			from = prevEnd
+		}
+		loc := thematicBreakRegex.FindIndex(source[from:])
+		if loc == nil {
+			continue
+		}
+		addSection(from + loc[0])
+		start = from + loc[1]
+	}
+	addSection(len(source))
+
+	return sections
+}
+
+// nextBlockRange returns the end offset of the first following sibling of n
+// holding lines, or -1.
+func nextBlockRange(n ast.Node) int {
+	for n = n.NextSibling(); n != nil; n = n.NextSibling() {
+		if _, end, ok := blockRange(n); ok {
+			return end
+		}
+	}
+	return -1
+}
+
+// blockRange returns the byte offsets spanned by the lines of the given block
+// and its descendants.
+func blockRange(n ast.Node) (start int, end int, ok bool) {
+	start = -1
+	ast.Walk(n, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering || n.Type() != ast.TypeBlock {
+			return ast.WalkContinue, nil
+		}
+		lines := n.Lines()
+		if lines.Len() == 0 {
+			return ast.WalkContinue, nil
+		}
+		ok = true
+		if s := lines.At(0).Start; start == -1 || s < start {
+			start = s
+		}
+		if e := lines.At(lines.Len() - 1).Stop; e > end {
+			end = e
+		}
+		return ast.WalkContinue, nil
+	})
+	return
+}
+
+// nextBlankLine returns the offset of the first blank line following the
+// given offset, or the end of the source.
+func nextBlankLine(source []byte, offset int) int {
+	if offset > 0 && source[offset-1] != '\n' {
+		i := bytes.IndexByte(source[offset:], '\n')
+		if i == -1 {
+			return len(source)
+		}
+		offset += i + 1
+	}
+
+	for offset < len(source) {
+		lineEnd := len(source)
+		if i := bytes.IndexByte(source[offset:], '\n'); i != -1 {
+			lineEnd = offset + i + 1
+		}
+		if len(bytes.TrimSpace(source[offset:lineEnd])) == 0 {
+			return offset
+		}
+		offset = lineEnd
+	}
+	return len(source)
+}
+
+// parseFooterDate extracts the modification date from the last line of the
+// body starting with the configured prefix. The returned bool is false when
+// a footer was found but its date can't be parsed.
+func (p *Parser) parseFooterDate(body opt.String) (time.Time, bool) {
+	layouts := p.options.FooterDateLayouts
+	if len(layouts) == 0 {
+		layouts = []string{"2006-01-02"}
+	}
+	prefix := p.options.FooterDatePrefix
+
+	// Scans the lines from the end, as the footer is expected at the bottom.
+	text := body.Unwrap()
+	for len(text) > 0 {
+		line := text
+		if i := strings.LastIndexByte(text, '\n'); i != -1 {
+			line, text = text[i+1:], text[:i]
+		} else {
+			text = ""
+		}
+
+		line = strings.TrimSpace(line)
+		if len(line) < len(prefix) || !strings.EqualFold(line[:len(prefix)], prefix) {
+			continue
+		}
+
+		value := strings.TrimSpace(line[len(prefix):])
+		for _, layout := range layouts {
+			if date, err := time.Parse(layout, value); err == nil {
+				return date, true
+			}
+		}
+		return time.Time{}, false
+	}
+
+	return time.Time{}, true
+}
+
+// parseVisibility resolves the publication status of the note from the
+// `private` and `publish` frontmatter keys. A private note is never public.
+func parseVisibility(frontmatter frontmatter) core.Visibility {
+	private := frontmatter.getBool("private")
+	publish := frontmatter.getBool("publish")
+
+	switch {
+	case private.Unwrap():
+		return core.VisibilityPrivate
+	case !publish.IsNull():
+		if publish.Unwrap() {
+			return core.VisibilityPublic
+		}
+		return core.VisibilityPrivate
+	case !private.IsNull():
+		return core.VisibilityPublic
+	default:
+		return core.VisibilityUnspecified
+	}
+}
+
+// parseIsMOC returns whether the note is flagged as a Map of Content, either
+// with one of the configured boolean keys or with `type: moc`.
+func (p *Parser) parseIsMOC(frontmatter frontmatter) bool {
+	if isMOC := frontmatter.getBool(p.options.MOCKeys...); !isMOC.IsNull() {
+		return isMOC.Unwrap()
+	}
+	// The type is only consumed when it flags the note as a MOC.
+	key := frontmatter.key("type")
+	if val, ok := frontmatter.lookup(key); ok {
+		if val, ok := val.(string); ok && strings.EqualFold(strings.TrimSpace(val), "moc") {
+			frontmatter.consume(key)
+			return true
+		}
+	}
+	return false
+}
+
+// parseGeo extracts the coordinates of the note from the first of the given
+// frontmatter keys, either:
+// * a `lat,lng` string, e.g. `48.85,2.35`
+// * a map, e.g. `{lat: 48.85, lng: 2.35}`
+func parseGeo(frontmatter frontmatter, keys []string) (*core.Geo, error) {
+	for _, key := range keys {
+		key = frontmatter.key(key)
+		val, ok := frontmatter.lookup(key)
+		if !ok || val == nil {
+			continue
+		}
+
+		var lat, lng interface{}
+		switch val := val.(type) {
+		case string:
+			if parts := strings.Split(val, ","); len(parts) == 2 {
+				lat, lng = parts[0], parts[1]
+			}
+		case map[string]interface{}:
+			lat = val["lat"]
+			for _, k := range []string{"lng", "lon", "long"} {
+				if v, ok := val[k]; ok {
+					lng = v
+					break
+				}
+			}
+		}
+
+		geo := core.Geo{}
+		var latOk, lngOk bool
+		geo.Lat, latOk = parseCoordinate(lat, 90)
+		geo.Lng, lngOk = parseCoordinate(lng, 180)
+		if !latOk || !lngOk {
+			return nil, fmt.Errorf("the %s %q is not a valid lat,lng coordinate", key, fmt.Sprint(val))
+		}
+		frontmatter.consume(key)
+		return &geo, nil
+	}
+	return nil, nil
+}
+
+// parseCoordinate converts a frontmatter value to a coordinate in decimal
+// degrees, between -max and max.
+func parseCoordinate(val interface{}, max float64) (float64, bool) {
+	var coord float64
+	switch val := val.(type) {
+	case float64:
+		coord = val
+	case int:
+		coord = float64(val)
+	case string:
+		var err error
+		coord, err = strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if err != nil {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	return coord, coord >= -max && coord <= max
+}
+
+// isAllowedStatus returns whether the given status is part of the
+// StatusValues option.
+func (p *Parser) isAllowedStatus(status string) bool {
+	if p.options.StatusValues == nil {
+		return true
+	}
+	for _, value := range p.options.StatusValues {
+		if strings.EqualFold(value, status) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSeries extracts the series the note belongs to from the frontmatter.
+func (p *Parser) parseSeries(frontmatter frontmatter) []string {
+	if series, ok := frontmatter.getStrings(p.options.SeriesKeys...); ok {
+		return series
+	}
+	if series := frontmatter.getString(p.options.SeriesKeys...); !series.IsNull() {
+		return []string{strings.TrimSpace(series.Unwrap())}
+	}
+	return []string{}
+}
+
+// parseAttachments extracts the paths of the files attached to the note in
+// the frontmatter.
+func (p *Parser) parseAttachments(frontmatter frontmatter) []string {
+	if attachments, ok := frontmatter.getStrings(p.options.AttachmentKeys...); ok {
+		return attachments
+	}
+	if attachment := frontmatter.getString(p.options.AttachmentKeys...); !attachment.IsNull() {
+		return []string{strings.TrimSpace(attachment.Unwrap())}
+	}
+	return []string{}
+}
+
+// parseCSSClasses extracts the Obsidian CSS classes styling the note, either
+// a list or a space-separated string, e.g. `cssclasses: [wide, dark]`.
+func parseCSSClasses(frontmatter frontmatter) []string {
+	keys := []string{"cssclasses", "cssclass"}
+	if classes, ok := frontmatter.getStrings(keys...); ok {
+		return classes
+	}
+	if classes := frontmatter.getString(keys...); !classes.IsNull() {
+		return strings.Fields(classes.Unwrap())
+	}
+	return []string{}
+}
+
+// wikiLinkValueRegex matches a frontmatter value written as a wiki link, e.g.
+// `[[Index]]`.
+var wikiLinkValueRegex = regexp.MustCompile(`^\[\[([^\]]+)\]\]$`)
+
+// parseFrontmatterLink extracts the target of a note declared in the
+// frontmatter for any of the given keys, either as a wiki link or a path,
+// with the matching link.
+func (p *Parser) parseFrontmatterLink(frontmatter frontmatter, keys []string, rel core.LinkRelation) (opt.String, *core.Link) {
+	link := p.newFrontmatterLink(frontmatter.getString(keys...).Unwrap(), rel)
+	if link == nil {
+		return opt.NullString, nil
+	}
+	return opt.NewString(link.Href), link
+}
+
+// parseRelationLinks extracts the links declared in the frontmatter with the
+// custom relations of the RelationKeys option, sorted by key.
+func (p *Parser) parseRelationLinks(frontmatter frontmatter) []core.Link {
+	keys := make([]string, 0, len(p.options.RelationKeys))
+	for key := range p.options.RelationKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	links := []core.Link{}
+	for _, key := range keys {
+		rel := core.LinkRelation(p.options.RelationKeys[key])
+		for _, value := range frontmatter.getLinkValues(key) {
+			if link := p.newFrontmatterLink(value, rel); link != nil {
+				links = append(links, *link)
+			}
+		}
+	}
+	return links
+}
+
+// parseDeclaredBacklinks extracts the targets of the notes declared as
+// linking to this one in the frontmatter, either as wiki links or paths.
+func (p *Parser) parseDeclaredBacklinks(frontmatter frontmatter) []string {
+	backlinks := []string{}
+	for _, key := range p.options.BacklinkKeys {
+		for _, value := range frontmatter.getLinkValues(key) {
+			if href, _, _ := p.parseLinkValue(value); href != "" {
+				backlinks = append(backlinks, href)
+			}
+		}
+	}
+	return strutil.RemoveDuplicates(backlinks)
+}
+
+// parseLinkValue extracts the target and label of a frontmatter value, either
+// a wiki link or a path.
+func (p *Parser) parseLinkValue(value string) (href string, label string, isWikiLink bool) {
+	href = strings.TrimSpace(value)
+	match := wikiLinkValueRegex.FindStringSubmatch(href)
+	if match == nil {
+		return href, "", false
+	}
+
+	href = match[1]
+	if i := strings.Index(href, "|"); i != -1 {
+		href, label = href[:i], href[i+1:]
+		if p.options.WikiLinkLabelFirst {
+			href, label = label, href
+		}
+	}
+	return strings.TrimSpace(href), strings.TrimSpace(label), true
+}
+
+// newFrontmatterLink creates the link declared by a frontmatter value, either
+// as a wiki link or a path.
+func (p *Parser) newFrontmatterLink(value string, rel core.LinkRelation) *core.Link {
+	href, label, isWikiLink := p.parseLinkValue(value)
+	if href == "" {
+		return nil
+	}
+
+	link := core.Link{
+		Href:  href,
+		Title: label,
+		Type:  core.LinkTypeMarkdown,
+		Rels:  []core.LinkRelation{rel},
+	}
+	if isWikiLink {
+		link.Type = core.LinkTypeWikiLink
+	}
+	link.IsExternal = strutil.IsURL(link.Href)
+
+	link = p.newLink(link)
+	return &link
+}
+
+// filterInlineTags drops the inline tags considered as noise, according to
+// the parser options.
+func (p *Parser) filterInlineTags(tags []string) []string {
+	if p.options.MinTagLength <= 1 && !p.options.DropNumericTags {
+		return tags
+	}
+
+	res := make([]string, 0)
+	for _, tag := range tags {
+		if p.isNoiseTag(tag) {
+			continue
+		}
+		res = append(res, tag)
+	}
+	return res
+}
+
+// isNoiseTag returns whether the given inline tag is too short or numeric
+// to be kept, according to the parser options.
+func (p *Parser) isNoiseTag(tag string) bool {
+	if utf8.RuneCountInString(tag) < p.options.MinTagLength {
+		return true
+	}
+	return p.options.DropNumericTags && strings.IndexFunc(tag, func(r rune) bool { return !unicode.IsNumber(r) }) == -1
+}
+
+// reportTags calls the OnTag callback with the frontmatter tags, then with
+// each inline tag occurrence in source order.
+func (p *Parser) reportTags(frontmatter frontmatter, elements astElements, source []byte) {
+	for _, tag := range parseFrontmatterTags(frontmatter, p.options.TagSubKeys) {
+		p.options.OnTag(tag, core.Position{})
+	}
+	for i, tag := range elements.tags {
+		if !p.isNoiseTag(tag) {
+			p.options.OnTag(tag, p.positionAt(elements.tagStarts[i], source))
+		}
+	}
+}
+
+// positionAt returns the position of the given byte offset in source.
+func (p *Parser) positionAt(offset int, source []byte) core.Position {
+	lineStart := bytes.LastIndexByte(source[:offset], '\n') + 1
+	return core.Position{
+		Offset: offset,
+		Line:   bytes.Count(source[:lineStart], []byte("\n")) + 1,
+		Column: utf8.RuneCount(source[lineStart:offset]) + 1,
+	}
+}
+
+// keywordWeightRegex matches a keyword with a weight suffix, e.g. `go:2`.
+var keywordWeightRegex = regexp.MustCompile(`^(.+?):([0-9]+(?:\.[0-9]+)?)$`)
+
+// splitKeywordWeight splits a keyword from its optional weight suffix. The
+// weight defaults to 1.
+func splitKeywordWeight(keyword string) (string, float64) {
+	if match := keywordWeightRegex.FindStringSubmatch(keyword); match != nil {
+		if weight, err := strconv.ParseFloat(match[2], 64); err == nil {
+			return strings.TrimSpace(match[1]), weight
+		}
+	}
+	return keyword, 1
+}
+
+// parseKeywords extracts the weighted search keywords from the frontmatter,
+// either:
+// * a list of `term:weight` strings, e.g. `[go:2, testing]`
+// * a list of maps, e.g. `[{go: 2}]`
+// * a single space-separated string
+func parseKeywords(frontmatter frontmatter) []core.Keyword {
+	keywords := []core.Keyword{}
+	found := map[string]bool{}
+	add := func(term string, weight float64) {
+		term = strings.TrimPrefix(strings.TrimSpace(term), "#")
+		if term == "" || found[term] {
+			return
+		}
+		found[term] = true
+		keywords = append(keywords, core.Keyword{Term: term, Weight: weight})
+	}
+
+	for _, key := range []string{"keyword", "keywords"} {
+		switch val := frontmatter.values[frontmatter.key(key)].(type) {
+		case []interface{}:
+			for _, item := range val {
+				if weights, ok := item.(map[string]interface{}); ok {
+					terms := make([]string, 0, len(weights))
+					for term := range weights {
+						terms = append(terms, term)
+					}
+					sort.Strings(terms)
+					for _, term := range terms {
+						weight, err := strconv.ParseFloat(fmt.Sprint(weights[term]), 64)
+						if err != nil {
+							weight = 1
+						}
+						add(term, weight)
+					}
+				} else {
+					add(splitKeywordWeight(strings.TrimSpace(fmt.Sprint(item))))
+				}
+			}
+		case string:
+			for _, s := range strings.Fields(val) {
+				add(splitKeywordWeight(s))
+			}
+		}
+	}
+	return keywords
+}
+
+// parseTags merges the tags found in the YAML frontmatter with the inline
+// #hashtags and :colon:tags:.
+//
+// When the frontmatter tags are a list of maps, the tag names are read from
+// the first of subKeys found in each map.
+func parseTags(frontmatter frontmatter, subKeys []string, inlineTags []string) []string {
+	tags := parseFrontmatterTags(frontmatter, subKeys)
+	tags = append(tags, inlineTags...)
+
+	return strutil.RemoveDuplicates(tags)
+}
+
+// parseFrontmatterTags extracts the tags of the YAML frontmatter, including
+// the search keywords.
+func parseFrontmatterTags(frontmatter frontmatter, subKeys []string) []string {
+	tags := make([]string, 0)
+
+	// Parse from YAML frontmatter, either:
+	// * a list of maps
+	// * a list of strings
+	// * a single space-separated string
+	findFMTags := func(key string) []string {
+		if tags, ok := frontmatter.getMapStrings(key, subKeys); ok {
+			return tags
+
+		} else if tags, ok := frontmatter.getStrings(key); ok {
+			return tags
+
+		} else if tags := frontmatter.getString(key); !tags.IsNull() {
+			// Parse a space-separated string list
+			res := []string{}
+			for _, s := range strings.Fields(tags.Unwrap()) {
+				s = strings.TrimSpace(s)
+				if len(s) > 0 {
+					res = append(res, s)
+				}
+			}
+			return res
+
+		} else {
+			return []string{}
+		}
+	}
+
+	for _, key := range []string{"tag", "tags", "keyword", "keywords"} {
+		for _, t := range findFMTags(key) {
+			if strings.HasPrefix(key, "keyword") {
+				t, _ = splitKeywordWeight(t)
+			}
+			// Trims any # prefix to support hashtags embedded in YAML
+			// frontmatter, as in Simple Markdown Zettelkasten:
+			// http://evantravers.com/articles/2020/11/23/zettelkasten-updates/
+			tags = append(tags, strings.TrimPrefix(t, "#"))
+		}
+	}
+
+	return tags
+}
+
+// inlineFieldRegex matches the key of a Dataview inline field, e.g.
+// `key:: value` or `[key:: value]`. A space is required after the `::` to
+// avoid matching C++ scopes such as `std::string`.
+var inlineFieldRegex = regexp.MustCompile(`(?:^|[\s\[(])([\p{L}\p{N}_-]+)::(?:[ \t]+|$)`)
+
+// parseInlineFields extracts Dataview inline fields from the note text,
+// ignoring code spans and code blocks.
+func parseInlineFields(root ast.Node, source []byte) (map[string][]string, error) {
+	fields := map[string][]string{}
+
+	err := walkProseLines(root, source, func(line string, start int) {
+		for _, match := range inlineFieldRegex.FindAllStringSubmatchIndex(line, -1) {
+			key := strings.ToLower(line[match[2]:match[3]])
+			value := line[match[1]:]
+
+			// A bracketed field ends with its closing bracket.
+			if match[0] < match[2] {
+				closing := ""
+				switch line[match[0]] {
+				case '[':
+					closing = "]"
+				case '(':
+					closing = ")"
+				}
+				if i := strings.Index(value, closing); closing != "" && i != -1 {
+					value = value[:i]
+				}
+			}
+
+			if value = strings.TrimSpace(value); value != "" {
+				fields[key] = append(fields[key], value)
+			}
+		}
+	})
+
+	return fields, err
+}
+
+// citationRegex matches a Pandoc citation key, e.g. `[@key]`, `[-@key]` or
+// `@key`. It must not be preceded by a word character to skip email
+// addresses.
+var citationRegex = regexp.MustCompile(`(?:^|[\s\[(;-])@([\p{L}\p{N}_][\p{L}\p{N}_:.#$%&+?<>~/-]*)`)
+
+// parseCitations extracts the unique Pandoc citation keys found in the note
+// text, ignoring code.
+func (p *Parser) parseCitations(root ast.Node, source []byte) ([]string, error) {
+	citations := []string{}
+
+	err := walkProseLines(root, source, func(line string, start int) {
+		for _, match := range citationRegex.FindAllStringSubmatch(line, -1) {
+			// Internal punctuation is allowed, but the key must end with an
+			// alphanumeric character.
+			key := strings.TrimRightFunc(match[1], func(r rune) bool {
+				return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '_'
+			})
+			if p.options.CitationKeyRegex != nil && !p.options.CitationKeyRegex.MatchString(key) {
+				continue
+			}
+			citations = append(citations, key)
+		}
+	})
+
+	return strutil.RemoveDuplicates(citations), err
+}
+
+// dateMentionRegex matches an ISO 8601 calendar date, e.g. `2021-05-01`.
+// Other formats such as `05/01/2021` are ambiguous and not supported.
+var dateMentionRegex = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+
+// isDateMentionBoundary returns whether the given character can surround a
+// date mention, to skip identifiers such as `v2021-05-01` or `2021-05-01-1`.
+func isDateMentionBoundary(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r) && !strings.ContainsRune("_-/", r)
+}
+
+// parseDateMentions extracts the unique dates mentioned in the note text, in
+// order of appearance. Dates found in code or links are ignored.
+func parseDateMentions(root ast.Node, source []byte) ([]time.Time, error) {
+	dates := []time.Time{}
+	found := map[time.Time]bool{}
+
+	err := ast.Walk(root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Link, *extensions.WikiLink, *ast.AutoLink, *ast.CodeSpan, *ast.RawHTML, *ast.HTMLBlock, *ast.FencedCodeBlock, *ast.CodeBlock:
+			return ast.WalkSkipChildren, nil
+		case *ast.Text:
+			text := n.Segment.Value(source)
+			for _, match := range dateMentionRegex.FindAllIndex(text, -1) {
+				if before, _ := utf8.DecodeLastRune(text[:match[0]]); match[0] > 0 && !isDateMentionBoundary(before) {
+					continue
+				}
+				if after, _ := utf8.DecodeRune(text[match[1]:]); match[1] < len(text) && !isDateMentionBoundary(after) {
+					continue
+				}
+				date, err := time.Parse("2006-01-02", string(text[match[0]:match[1]]))
+				if err != nil || found[date] {
+					continue
+				}
+				found[date] = true
+				dates = append(dates, date)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	return dates, err
+}
+
+// referenceLinkRegex matches a full or collapsed reference link, e.g.
+// `[text][ref]` or `[text][]`.
+var referenceLinkRegex = regexp.MustCompile(`\[([^\[\]]+)\]\[([^\[\]]*)\]`)
+
+// parseUndefinedReferences returns the unique labels of the reference links
+// without a matching definition, e.g. `[text][missing]`. The defined ones are
+// already parsed as regular links.
+//
+// Like the definitions, the labels are compared regardless of case.
+func parseUndefinedReferences(root ast.Node, source []byte, context parser.Context) ([]string, error) {
+	refs := []string{}
+	found := map[string]bool{}
+
+	err := walkProseLines(root, source, func(line string, start int) {
+		for _, match := range referenceLinkRegex.FindAllStringSubmatchIndex(line, -1) {
+			if match[0] > 0 && line[match[0]-1] == '\\' {
+				continue
+			}
+			label := line[match[4]:match[5]]
+			if label == "" {
+				label = line[match[2]:match[3]]
+			}
+			key := gutil.ToLinkReference([]byte(label))
+			if _, ok := context.Reference(key); !ok && !found[key] {
+				found[key] = true
+				refs = append(refs, label)
+			}
+		}
+	})
+
+	return refs, err
+}
+
+// newMentionRegex creates the pattern matching a @mention made of letters,
+// digits and the given additional characters.
+//
+// A mention must not be preceded by a word character to skip email
+// addresses, nor by a bracket to skip Pandoc citations.
+func newMentionRegex(charset string) *regexp.Regexp {
+	class := `\p{L}\p{N}`
+	for _, c := range charset {
+		class += fmt.Sprintf(`\x{%x}`, c)
+	}
+	return regexp.MustCompile(`(?:^|[\s(])@([` + class + `]+)`)
+}
+
+// parseMentions extracts the unique @mentions found in the note text,
+// ignoring code.
+func (p *Parser) parseMentions(root ast.Node, source []byte) ([]string, error) {
+	mentions := []string{}
+
+	err := walkProseLines(root, source, func(line string, start int) {
+		for _, match := range p.mentionRegex.FindAllStringSubmatch(line, -1) {
+			mentions = append(mentions, match[1])
+		}
+	})
+
+	return strutil.RemoveDuplicates(mentions), err
+}
+
+// astElements holds the elements extracted during a traversal of the note
+// AST.
+type astElements struct {
+	links        []core.Link
+	childLinks   []core.Link
+	tags         []string
+	tagStarts    []int
+	codeKeywords []string
+	directives   []string
+	tables       []core.Table
+	lists        []core.List
+	images       []core.Image
+	footnotes    []core.Footnote
+	callouts     []core.Callout
+	headings     []core.Heading
+	anchors      []string
+	hasSelfEmbed bool
+	stats        core.NoteStats
+}
+
+// parseTable extracts the cells of a GFM table, flattened to plain text.
+func parseTable(table ast.Node, source []byte) core.Table {
+	r := plainRenderer{source: source}
+	res := core.Table{Header: []string{}, Rows: [][]string{}}
+
+	for row := table.FirstChild(); row != nil; row = row.NextSibling() {
+		cells := []string{}
+		for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			cells = append(cells, r.renderInlines(cell))
+		}
+
+		if row.Kind() == east.KindTableHeader {
+			res.Header = cells
+		} else {
+			res.Rows = append(res.Rows, cells)
+		}
+	}
+	return res
+}
+
+// countWords returns the number of words in the given text. The punctuation
+// left alone by the inline markup, e.g. the `.` after a link, is not a word.
+func countWords(text []byte) int {
+	count := 0
+	for _, field := range bytes.Fields(text) {
+		if bytes.IndexFunc(field, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsNumber(r) }) != -1 {
+			count++
+		}
+	}
+	return count
+}
+
+// isNestedList returns whether the given list is part of a list item.
+func isNestedList(list ast.Node) bool {
+	for n := list.Parent(); n != nil; n = n.Parent() {
+		if n.Kind() == ast.KindListItem {
+			return true
+		}
+	}
+	return false
+}
+
+// isDescendant returns whether n is a descendant of the given ancestor.
+func isDescendant(n ast.Node, ancestor ast.Node) bool {
+	if ancestor == nil {
+		return false
+	}
+	for n = n.Parent(); n != nil; n = n.Parent() {
+		if n == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// parseList extracts the raw Markdown text of a list, including its markers
+// and any code block found in its items.
+func parseList(list *ast.List, source []byte) (core.List, bool) {
+	start, end, ok := blockRange(list)
+	if !ok {
+		return core.List{}, false
+	}
+	start = bytes.LastIndexByte(source[:start], '\n') + 1
+
+	// The lines of a fenced code block don't include its closing fence, so
+	// it needs to be added when the list ends with one.
+	var last ast.Node = list
+	for last.LastChild() != nil && last.LastChild().Type() == ast.TypeBlock {
+		last = last.LastChild()
+	}
+	if _, ok := last.(*ast.FencedCodeBlock); ok && end < len(source) {
+		next := end
+		if i := bytes.IndexByte(source[next:], '\n'); i != -1 {
+			next += i + 1
+		} else {
+			next = len(source)
+		}
+		if fence := strings.TrimSpace(string(source[end:next])); strings.HasPrefix(fence, "```") || strings.HasPrefix(fence, "~~~") {
+			end = next
+		}
+	}
+
+	return core.List{
+		Text:    strings.TrimRightFunc(string(source[start:end]), unicode.IsSpace),
+		Ordered: list.IsOrdered(),
+		Depth:   listDepth(list),
+	}, true
+}
+
+// listDepth returns the maximum nesting depth of the items of a list,
+// starting at 1.
+func listDepth(list ast.Node) int {
+	depth := 1
+	ast.Walk(list, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering && n != list && n.Kind() == ast.KindList {
+			if d := 1 + listDepth(n); d > depth {
+				depth = d
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return depth
+}
+
+// calloutRegex matches the first line of an Obsidian callout, e.g.
+// `[!warning] Title`. An optional `+` or `-` makes the callout foldable.
+var calloutRegex = regexp.MustCompile(`^\[!([a-zA-Z][a-zA-Z0-9_-]*)\][+-]?(?:[ \t]+(.*))?$`)
+
+// parseCallout extracts an Obsidian callout from a blockquote, as plain
+// text.
+func parseCallout(blockquote ast.Node, source []byte) (core.Callout, bool) {
+	if !ast.IsParagraph(blockquote.FirstChild()) {
+		return core.Callout{}, false
+	}
+
+	r := plainRenderer{source: source}
+	text := r.renderChildren(blockquote, 0, "\n\n")
+	firstLine, body := text, ""
+	if i := strings.Index(text, "\n"); i != -1 {
+		firstLine, body = text[:i], text[i+1:]
+	}
+
+	match := calloutRegex.FindStringSubmatch(strings.TrimSpace(firstLine))
+	if match == nil {
+		return core.Callout{}, false
+	}
+	return core.Callout{
+		Type:  strings.ToLower(match[1]),
+		Title: strings.TrimSpace(match[2]),
+		Body:  strings.TrimSpace(body),
+	}, true
+}
+
+// directiveRegex matches a zk directive written in an HTML comment, e.g.
+// `<!-- zk:noindex -->`.
+var directiveRegex = regexp.MustCompile(`<!--\s*zk:([a-zA-Z0-9_-]+)\s*-->`)
+
+// parseDirectives returns the lowercased names of the directives found in
+// the given raw HTML.
+func parseDirectives(html []byte) []string {
+	directives := []string{}
+	for _, match := range directiveRegex.FindAllSubmatch(html, -1) {
+		directives = append(directives, strings.ToLower(string(match[1])))
+	}
+	return directives
+}
+
+// htmlImageRegex matches an HTML <img> tag, capturing its attributes.
+var htmlImageRegex = regexp.MustCompile(`(?i)<img\b([^<>]*)>`)
+
+// htmlAnchorRegex matches an HTML <a> tag, capturing its attributes.
+var htmlAnchorRegex = regexp.MustCompile(`(?i)<a\b([^<>]*)>`)
+
+// htmlAttributeRegex matches the src, alt, id or name attribute of an HTML tag, with
+// a double-quoted, single-quoted or unquoted value.
+var htmlAttributeRegex = regexp.MustCompile(`(?i)(?:^|\s)(src|alt|id|name)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'=<>` + "`" + `]+))`)
+
+// parseHTMLImages returns the images embedded with <img> tags in the given
+// raw HTML. Tags without a src attribute are skipped.
+func parseHTMLImages(source []byte) []core.Image {
+	images := []core.Image{}
+	for _, tag := range htmlImageRegex.FindAllSubmatch(source, -1) {
+		image := core.Image{HTML: true}
+		for _, attr := range htmlAttributeRegex.FindAllSubmatch(tag[1], -1) {
+			value := html.UnescapeString(string(attr[2]) + string(attr[3]) + string(attr[4]))
+			switch strings.ToLower(string(attr[1])) {
+			case "src":
+				image.Src = strings.TrimSpace(value)
+			case "alt":
+				image.Alt = value
+			}
+		}
+		if image.Src != "" {
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
+// parseHTMLAnchors extracts the id or name of the HTML <a> tags.
+func parseHTMLAnchors(source []byte) []string {
+	anchors := []string{}
+	for _, tag := range htmlAnchorRegex.FindAllSubmatch(source, -1) {
+		for _, attr := range htmlAttributeRegex.FindAllSubmatch(tag[1], -1) {
+			switch strings.ToLower(string(attr[1])) {
+			case "id", "name":
+				value := html.UnescapeString(string(attr[2]) + string(attr[3]) + string(attr[4]))
+				if value = strings.TrimSpace(value); value != "" {
+					anchors = append(anchors, value)
+				}
+			}
+		}
+	}
+	return anchors
+}
+
+// walkAST extracts outbound links, inline tags, code keywords, directives,
+// images, tables, footnotes, callouts, headings and structure statistics from the
+// note.
+//
+// The custom visitors are called during this traversal of the AST.
+func (p *Parser) walkAST(root ast.Node, source []byte) (astElements, error) {
+	links := make([]core.Link, 0)
+	childLinks := make([]core.Link, 0)
+	tags := make([]string, 0)
+	tagStarts := make([]int, 0)
+	codeKeywords := make([]string, 0)
+	directives := make([]string, 0)
+	tables := make([]core.Table, 0)
+	lists := make([]core.List, 0)
+	images := make([]core.Image, 0)
+	footnotes := make([]core.Footnote, 0)
+	callouts := make([]core.Callout, 0)
+	headings := make([]core.Heading, 0)
+	anchors := make([]string, 0)
+	hasSelfEmbed := false
+	stats := core.NoteStats{}
+
+	// Indices of the headings containing the current node, used to count
+	// the words of their section and to find the heading path of links.
+	sections := []int{}
+	inHeading := false
+	quoteDepth := 0
+	// First top-level list of the note, holding the child links.
+	var childList ast.Node
+
+	err := ast.Walk(root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		for _, visitor := range p.options.Visitors {
+			visitor(n, entering, source)
+		}
+
+		if n.Kind() == ast.KindHeading {
+			inHeading = entering
+		}
+		if n.Kind() == ast.KindBlockquote {
+			if entering {
+				quoteDepth++
+			} else {
+				quoteDepth--
+			}
+		}
+
+		if entering {
+			switch n.Kind() {
+			case ast.KindHeading:
+				stats.Headings++
+				level := n.(*ast.Heading).Level
+				text := headingText(n, source)
+				anchor := p.options.SlugStyle.Slugify(text)
+				headings = append(headings, core.Heading{
+					Level:  level,
+					Text:   text,
+					Anchor: anchor,
+				})
+				anchors = append(anchors, anchor)
+				// A section ends with the next heading of equal or higher level.
+				for len(sections) > 0 && headings[sections[len(sections)-1]].Level >= level {
+					sections = sections[:len(sections)-1]
+				}
+				sections = append(sections, len(headings)-1)
+			case ast.KindText:
+				// The content of code blocks is not made of text nodes, so it
+				// is not counted.
+				if !inHeading && (quoteDepth == 0 || !p.options.SkipQuotesInWordCount) {
+					words := countWords(n.(*ast.Text).Segment.Value(source))
+					stats.Words += words
+					for _, i := range sections {
+						headings[i].WordCount += words
+					}
+				}
+			case ast.KindImage:
+				stats.Images++
+				images = append(images, core.Image{
+					Src: string(n.(*ast.Image).Destination),
+					Alt: string(n.Text(source)),
+				})
+			case ast.KindFencedCodeBlock, ast.KindCodeBlock:
+				stats.CodeBlocks++
+			case ast.KindList:
+				if childList == nil && !isNestedList(n) {
+					childList = n
+				}
+				if p.options.ListsEnabled && !isNestedList(n) {
+					if list, ok := parseList(n.(*ast.List), source); ok {
+						lists = append(lists, list)
+					}
+				}
+			case ast.KindListItem:
+				stats.ListItems++
+			case extensions.KindTags:
+				tagsNode := n.(*extensions.Tags)
+				tags = append(tags, tagsNode.Tags...)
+				for range tagsNode.Tags {
+					tagStarts = append(tagStarts, tagsNode.Start)
+				}
+			case ast.KindHTMLBlock:
+				var html bytes.Buffer
+				lines := n.Lines()
+				for i := 0; i < lines.Len(); i++ {
+					line := lines.At(i)
+					html.Write(line.Value(source))
+				}
+				directives = append(directives, parseDirectives(html.Bytes())...)
+				images = append(images, parseHTMLImages(html.Bytes())...)
+				anchors = append(anchors, parseHTMLAnchors(html.Bytes())...)
+			case ast.KindRawHTML:
+				var html bytes.Buffer
+				segments := n.(*ast.RawHTML).Segments
+				for i := 0; i < segments.Len(); i++ {
+					segment := segments.At(i)
+					html.Write(segment.Value(source))
+				}
+				directives = append(directives, parseDirectives(html.Bytes())...)
+				images = append(images, parseHTMLImages(html.Bytes())...)
+				anchors = append(anchors, parseHTMLAnchors(html.Bytes())...)
+			case east.KindTable:
+				tables = append(tables, parseTable(n, source))
+			case ast.KindBlockquote:
+				if callout, ok := parseCallout(n, source); ok {
+					callouts = append(callouts, callout)
+				}
+			case east.KindFootnote:
+				r := plainRenderer{source: source}
+				footnotes = append(footnotes, core.Footnote{
+					Label: string(n.(*east.Footnote).Ref),
+					Text:  r.renderChildren(n, 0, "\n\n"),
+				})
+			case extensions.KindInlineFootnote:
+				segment := n.(*extensions.InlineFootnote).Segment
+				footnotes = append(footnotes, core.Footnote{
+					Text:   p.plainText(segment.Value(source)),
+					Inline: true,
+				})
+			case ast.KindCodeSpan:
+				if p.options.CodeKeywordsEnabled {
+					if keyword := strings.TrimSpace(string(n.Text(source))); keyword != "" {
+						codeKeywords = append(codeKeywords, keyword)
+					}
+				}
 			}
 		}
-		return ast.WalkContinue, nil
-	})
-
-	return strutil.RemoveDuplicates(tags), err
-}
-
-// parseLinks extracts outbound links from the note.
-func (p *Parser) parseLinks(root ast.Node, source []byte) ([]core.Link, error) {
-	links := make([]core.Link, 0)
 
-	err := ast.Walk(root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
 		if entering {
+			count := len(links)
 			switch link := n.(type) {
 			case *ast.Link:
 				href, err := url.PathUnescape(string(link.Destination))
 				p.logger.Err(err)
 				if href != "" {
 					snippet, snStart, snEnd := extractLines(n, source)
-					links = append(links, core.Link{
+					links = append(links, p.newLink(core.Link{
 						Title:        string(link.Text(source)),
 						Href:         href,
 						Type:         core.LinkTypeMarkdown,
@@ -232,7 +2365,7 @@ func (p *Parser) parseLinks(root ast.Node, source []byte) ([]core.Link, error) {
 						Snippet:      snippet,
 						SnippetStart: snStart,
 						SnippetEnd:   snEnd,
-					})
+					}))
 				}
 
 			case *ast.AutoLink:
@@ -252,9 +2385,12 @@ func (p *Parser) parseLinks(root ast.Node, source []byte) ([]core.Link, error) {
 
 			case *extensions.WikiLink:
 				href := string(link.Destination)
+				if link.Embed && p.isSelfTarget(href) {
+					hasSelfEmbed = true
+				}
 				if href != "" {
 					snippet, snStart, snEnd := extractLines(n, source)
-					links = append(links, core.Link{
+					links = append(links, p.newLink(core.Link{
 						Title:        string(link.Text(source)),
 						Href:         href,
 						Type:         core.LinkTypeWikiLink,
@@ -263,13 +2399,186 @@ func (p *Parser) parseLinks(root ast.Node, source []byte) ([]core.Link, error) {
 						Snippet:      snippet,
 						SnippetStart: snStart,
 						SnippetEnd:   snEnd,
-					})
+					}))
+				}
+			}
+
+			if p.options.LinkPositionsEnabled && len(links) > count {
+				if start, ok := linkStart(n, source); ok {
+					p.setLinkPosition(&links[len(links)-1], start, source)
+				}
+			}
+			if p.options.LinkHeadingPathsEnabled && len(links) > count {
+				path := make([]string, 0, len(sections))
+				for _, i := range sections {
+					path = append(path, headings[i].Text)
 				}
+				links[len(links)-1].HeadingPath = path
+			}
+			if p.options.ChildLinksEnabled && len(links) > count && links[len(links)-1].Type == core.LinkTypeWikiLink && isDescendant(n, childList) {
+				childLinks = append(childLinks, links[len(links)-1])
 			}
 		}
 		return ast.WalkContinue, nil
 	})
-	return links, err
+
+	stats.Links = len(links)
+	return astElements{
+		links:        links,
+		childLinks:   childLinks,
+		tags:         tags,
+		tagStarts:    tagStarts,
+		codeKeywords: strutil.RemoveDuplicates(codeKeywords),
+		directives:   directives,
+		tables:       tables,
+		lists:        lists,
+		images:       images,
+		footnotes:    footnotes,
+		callouts:     callouts,
+		headings:     headings,
+		anchors:      strutil.RemoveDuplicates(anchors),
+		hasSelfEmbed: hasSelfEmbed,
+		stats:        stats,
+	}, err
+}
+
+// isSelfTarget returns whether the given link target is the parsed note
+// itself, according to the SelfTargets option. The targets are compared
+// without their file extension, fragment or case.
+func (p *Parser) isSelfTarget(href string) bool {
+	normalize := func(target string) string {
+		target, _, _ = splitLinkTarget(strings.TrimSpace(target))
+		return strings.ToLower(target)
+	}
+
+	href = normalize(href)
+	if href == "" {
+		return false
+	}
+	for _, self := range p.options.SelfTargets {
+		if self = normalize(self); self == href || self == path.Base(href) {
+			return true
+		}
+	}
+	return false
+}
+
+// linkStart returns the byte offset of the given link node in the source.
+func linkStart(n ast.Node, source []byte) (int, bool) {
+	switch n := n.(type) {
+	case *extensions.WikiLink:
+		return n.Start, true
+
+	case *ast.AutoLink:
+		// The node doesn't expose its position, so the URL is looked up in
+		// its paragraph.
+		_, start, end := extractLines(n, source)
+		if i := bytes.Index(source[start:end], n.Label(source)); i != -1 {
+			i += start
+			if i > 0 && source[i-1] == '<' {
+				i--
+			}
+			return i, true
+		}
+
+	case *ast.Link:
+		// The link starts with the bracket opening its label.
+		var label *ast.Text
+		ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+			if t, ok := c.(*ast.Text); ok && entering {
+				label = t
+				return ast.WalkStop, nil
+			}
+			return ast.WalkContinue, nil
+		})
+		if label != nil {
+			if i := bytes.LastIndexByte(source[:label.Segment.Start], '['); i != -1 {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// setLinkPosition sets the line and columns of the link starting at the
+// given byte offset.
+func (p *Parser) setLinkPosition(link *core.Link, start int, source []byte) {
+	lineStart := bytes.LastIndexByte(source[:start], '\n') + 1
+	link.Line = bytes.Count(source[:lineStart], []byte("\n")) + 1
+	link.Column = 1
+	link.VisualColumn = 1
+	for _, r := range string(source[lineStart:start]) {
+		link.Column++
+		if r == '\t' {
+			link.VisualColumn += p.options.TabWidth - (link.VisualColumn-1)%p.options.TabWidth
+		} else {
+			link.VisualColumn++
+		}
+	}
+}
+
+// newLink completes the given link with the components of its target, if
+// it is internal.
+func (p *Parser) newLink(link core.Link) core.Link {
+	if link.IsExternal {
+		return link
+	}
+
+	link.Target, link.Ext, link.Fragment = splitLinkTarget(link.Href)
+	if p.options.LinkTargetLowercase {
+		link.NormalizedTarget = strings.ToLower(strings.TrimSpace(link.Target))
+	}
+	if p.options.LinkResolver != nil {
+		link.ResolvedID, link.Resolved = p.options.LinkResolver(link.Href)
+	}
+	return link
+}
+
+// windowsPathRegex matches the drive letter of an absolute Windows path, e.g.
+// `C:\` or `C:/`.
+var windowsPathRegex = regexp.MustCompile(`^[a-zA-Z]:[\\/]`)
+
+// isAbsolutePath returns whether the given link href is an absolute file
+// path, either POSIX or Windows.
+func isAbsolutePath(href string) bool {
+	return strings.HasPrefix(href, "/") || strings.HasPrefix(href, `\\`) || windowsPathRegex.MatchString(href)
+}
+
+// checkLinkText returns a warning if the visible text of the given link is
+// not meaningful, e.g. for screen readers.
+func (p *Parser) checkLinkText(link core.Link) (string, bool) {
+	text := strings.TrimSpace(link.Title)
+	switch {
+	case text == "":
+		return fmt.Sprintf("the link %q has no text", link.Href), true
+	case strutil.IsURL(text):
+		return fmt.Sprintf("the link %q has a bare URL as text", link.Href), true
+	}
+
+	trimmed := strings.TrimRightFunc(text, unicode.IsPunct)
+	for _, vague := range p.options.VagueLinkTexts {
+		if strings.EqualFold(trimmed, vague) {
+			return fmt.Sprintf("the link %q has a meaningless text %q", link.Href, text), true
+		}
+	}
+	return "", false
+}
+
+var linkExtRegex = regexp.MustCompile(`^\.[a-zA-Z][a-zA-Z0-9]*$`)
+
+// splitLinkTarget splits an internal link href into its path, file extension
+// and fragment, e.g. `folder/note.md#section`.
+func splitLinkTarget(href string) (target string, ext string, fragment string) {
+	target = href
+	if i := strings.Index(target, "#"); i != -1 {
+		target, fragment = target[:i], target[i+1:]
+	}
+
+	// Numbered titles such as `Chapter 1.2` don't have any extension.
+	if e := path.Ext(target); linkExtRegex.MatchString(e) {
+		target, ext = strings.TrimSuffix(target, e), e[1:]
+	}
+	return
 }
 
 func extractLines(n ast.Node, source []byte) (content string, start, end int) {
@@ -296,59 +2605,640 @@ func extractLines(n ast.Node, source []byte) (content string, start, end int) {
 // frontmatter contains metadata parsed from a YAML frontmatter.
 type frontmatter struct {
 	values map[string]interface{}
+	format core.FrontmatterFormat
 	start  int
 	end    int
+	// Indicates whether the closing fence is missing, in which case the
+	// frontmatter spans until the end of the note.
+	unterminated bool
+	// Keys read by the getters to fill note fields.
+	consumed map[string]bool
+	// Indicates whether the keys are matched exactly as written.
+	caseSensitive bool
+	// Lines skipped while recovering a frontmatter which can't be decoded.
+	unrecovered []string
 }
 
 var frontmatterRegex = regexp.MustCompile(`(?ms)^\s*-+\s*$.*?^\s*-+\s*$`)
 
-func parseFrontmatter(context parser.Context, source []byte) (frontmatter, error) {
+// frontmatterOpeningFenceRegex matches the opening fence of a frontmatter,
+// with an optional info string, e.g. `---yaml` or `--- yaml`.
+var frontmatterOpeningFenceRegex = regexp.MustCompile(`\A\s*-{3,}[ \t]*([a-zA-Z]+)?[ \t]*\r?(?:\n|\z)`)
+
+// frontmatterClosingFenceRegex matches the closing fence of a frontmatter,
+// either `---` or the YAML end-of-document marker `...`.
+var frontmatterClosingFenceRegex = regexp.MustCompile(`(?m)^[ \t]*(-+|\.\.\.)[ \t]*\r?$`)
+
+// tomlFrontmatterRegex matches a TOML frontmatter fenced with `+++`.
+var tomlFrontmatterRegex = regexp.MustCompile(`(?ms)\A\s*(\+{3})[ \t]*\r?\n(.*?)^(\+{3})[ \t]*\r?$`)
+
+// frontmatterFence holds the hints taken from the frontmatter fences by
+// normalizeFrontmatterFences.
+type frontmatterFence struct {
+	// Lowercased info string of the opening fence, e.g. `json`.
+	info string
+	// Content of a TOML frontmatter, which is blanked out in the normalized
+	// source.
+	toml []byte
+}
+
+// utf8BOM is the byte order mark written by some editors at the start of
+// UTF-8 files.
+var utf8BOM = []byte("\uFEFF")
+
+// prepareSource returns the source of the given note content to be parsed,
+// with its frontmatter fences normalized and their hints.
+//
+// A leading byte order mark is blanked out rather than removed, to keep the
+// offsets identical to the note content.
+//
+// The normalizations copy the source before rewriting it, and the parsing
+// helpers only read from it.
+func (p *Parser) prepareSource(content string) ([]byte, frontmatterFence) {
+	source := []byte(content)
+	if bytes.HasPrefix(source, utf8BOM) {
+		copy(source, "   ")
+	}
+	if p.options.FrontmatterDisabled {
+		return source, frontmatterFence{}
+	}
+	return normalizeFrontmatterFences(source)
+}
+
+// normalizeFrontmatterFences rewrites the frontmatter fences which are not
+// understood by the YAML frontmatter extension:
+//
+//   - The info string of the opening fence is blanked out, and returned to be
+//     used as a format hint.
+//   - A `...` closing fence is replaced by `---`.
+//   - The `+++` fences of a TOML frontmatter are replaced by `---`, and its
+//     content is blanked out and returned to be decoded separately.
+//
+// The fences are rewritten with the same length to keep the offsets of the
+// AST nodes identical to the original source.
+func normalizeFrontmatterFences(source []byte) ([]byte, frontmatterFence) {
+	if match := tomlFrontmatterRegex.FindSubmatchIndex(source); match != nil {
+		normalized := make([]byte, len(source))
+		copy(normalized, source)
+
+		copy(normalized[match[2]:], "---")
+		copy(normalized[match[6]:], "---")
+		for i := match[4]; i < match[5]; i++ {
+			if normalized[i] != '\n' {
+				normalized[i] = ' '
+			}
+		}
+
+		content := append([]byte{}, source[match[4]:match[5]]...)
+		return normalized, frontmatterFence{info: "toml", toml: content}
+	}
+
+	opening := frontmatterOpeningFenceRegex.FindSubmatchIndex(source)
+	if opening == nil {
+		return source, frontmatterFence{}
+	}
+
+	normalized := make([]byte, len(source))
+	copy(normalized, source)
+
+	info := ""
+	if opening[2] != -1 {
+		info = strings.ToLower(string(source[opening[2]:opening[3]]))
+		for i := opening[2]; i < opening[3]; i++ {
+			normalized[i] = ' '
+		}
+	}
+
+	closing := frontmatterClosingFenceRegex.FindSubmatchIndex(source[opening[1]:])
+	if closing != nil && source[opening[1]+closing[2]] == '.' {
+		copy(normalized[opening[1]+closing[2]:], "---")
+	}
+
+	return normalized, frontmatterFence{info: info}
+}
+
+// frontmatterOpeningRegex matches an opening fence which is never closed,
+// e.g. in a truncated note.
+var frontmatterOpeningRegex = regexp.MustCompile(`(?s)\A\s*-+[ \t]*(\r?\n.*)?\z`)
+
+// parseFrontmatter extracts the frontmatter decoded by the YAML frontmatter
+// extension, or the TOML frontmatter held by the fence hints. The fence info
+// string is an optional format hint.
+//
+// The keys are lowercased, unless caseSensitive is true.
+func parseFrontmatter(context parser.Context, source []byte, fence frontmatterFence, caseSensitive bool, lenient bool) (frontmatter, error) {
 	var front frontmatter
 	front.values = map[string]interface{}{}
+	front.consumed = map[string]bool{}
+	front.caseSensitive = caseSensitive
 
 	index := frontmatterRegex.FindIndex(source)
 	if index == nil {
-		return front, nil
+		if index = frontmatterOpeningRegex.FindIndex(source); index == nil {
+			return front, nil
+		}
+		front.unterminated = true
 	}
 
-	front.start = index[0]
-	front.end = index[1]
+	if fence.toml != nil {
+		return parseTOMLFrontmatter(front, fence.toml, index, lenient)
+	}
 
 	values, err := meta.TryGet(context)
 	if err != nil {
-		return front, err
+		if front.unterminated {
+			// The opening fence was most likely a thematic break, so we
+			// fall back on treating the whole note as body.
+			return frontmatter{values: front.values, consumed: front.consumed}, nil
+		}
+		if !lenient {
+			return front, err
+		}
+		values, front.unrecovered = recoverFrontmatter(source[index[0]:index[1]])
+	}
+	if values == nil {
+		// The fences were found in the body, not at the start of the note.
+		return frontmatter{values: front.values, consumed: front.consumed}, nil
+	}
+	if len(values) == 0 && front.unterminated {
+		// Nothing worth treating as metadata after the opening fence.
+		return frontmatter{values: front.values, consumed: front.consumed}, nil
+	}
+
+	front.format = core.FrontmatterFormatYAML
+	if fence.info == "json" || isJSONFrontmatter(source[index[0]:index[1]]) {
+		// JSON is a subset of YAML, so it is decoded by the YAML parser.
+		front.format = core.FrontmatterFormatJSON
 	}
+	front.start = index[0]
+	front.end = index[1]
 
 	// The YAML parser parses nested maps as map[interface{}]interface{}
 	// instead of map[string]interface{}, which doesn't work with the JSON
 	// marshaller.
 	values = yaml.ConvertMapToJSONCompatible(values)
 
-	// Convert keys to lowercase, because we don't want to be case sensitive.
+	// Convert keys to lowercase by default, because we don't want to be case
+	// sensitive.
 	for k, v := range values {
-		front.values[strings.ToLower(k)] = v
+		front.values[front.key(k)] = v
+	}
+
+	return front, nil
+}
+
+// isJSONFrontmatter returns whether the content of the given fenced
+// frontmatter is a JSON object.
+func isJSONFrontmatter(source []byte) bool {
+	i := bytes.IndexByte(source, '\n')
+	if i == -1 {
+		return false
+	}
+	return bytes.HasPrefix(bytes.TrimSpace(source[i+1:]), []byte("{"))
+}
+
+// parseTOMLFrontmatter decodes the content of a TOML frontmatter spanning
+// the given source index.
+func parseTOMLFrontmatter(front frontmatter, content []byte, index []int, lenient bool) (frontmatter, error) {
+	front.format = core.FrontmatterFormatTOML
+	front.start = index[0]
+	front.end = index[1]
+
+	tree, err := toml.LoadBytes(content)
+	if err != nil {
+		if !lenient {
+			return front, err
+		}
+		// TOML can't be decoded line by line like YAML, as the keys
+		// depend on the preceding table headers.
+		for _, line := range strings.Split(string(content), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				front.unrecovered = append(front.unrecovered, line)
+			}
+		}
+		return front, nil
 	}
 
+	for k, v := range tree.ToMap() {
+		front.values[front.key(k)] = v
+	}
 	return front, nil
 }
 
+// recoverFrontmatter decodes the lines of a malformed frontmatter one by
+// one, returning the `key: value` pairs which can be decoded on their own
+// and the other lines.
+func recoverFrontmatter(source []byte) (values map[string]interface{}, unrecovered []string) {
+	values = map[string]interface{}{}
+	unrecovered = []string{}
+
+	lines := strings.Split(strings.TrimSpace(string(source)), "\n")
+	if len(lines) < 2 {
+		return
+	}
+	// Skips the fences.
+	for _, line := range lines[1 : len(lines)-1] {
+		line = strings.TrimRight(line, " \t\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		// Indented lines belong to the value of a previous key, which
+		// can't be decoded alone.
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			unrecovered = append(unrecovered, line)
+			continue
+		}
+
+		pair := map[string]interface{}{}
+		if err := goyaml.Unmarshal([]byte(line), &pair); err != nil || len(pair) != 1 {
+			unrecovered = append(unrecovered, line)
+			continue
+		}
+		for key, value := range pair {
+			if value == nil {
+				unrecovered = append(unrecovered, line)
+				continue
+			}
+			values[key] = value
+		}
+	}
+	return
+}
+
+// key returns the normalized form of a frontmatter key.
+func (m frontmatter) key(key string) string {
+	if m.caseSensitive {
+		return key
+	}
+	return strings.ToLower(key)
+}
+
+// lookup returns the value of the given key, which can be a dotted path into
+// nested maps, e.g. `meta.author` for `meta: {author: Mickaël}`. A top-level
+// key containing dots is preferred over the path.
+func (m frontmatter) lookup(key string) (interface{}, bool) {
+	if val, ok := m.values[key]; ok {
+		return val, true
+	}
+	if !strings.Contains(key, ".") {
+		return nil, false
+	}
+
+	var val interface{} = m.values
+	for _, part := range strings.Split(key, ".") {
+		values, isMap := val.(map[string]interface{})
+		if !isMap {
+			return nil, false
+		}
+		var found bool
+		if val, found = values[part]; found {
+			continue
+		}
+		// The keys of nested maps keep their original case.
+		if !m.caseSensitive {
+			for k, v := range values {
+				if strings.EqualFold(k, part) {
+					val, found = v, true
+					break
+				}
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return val, true
+}
+
+// consume records that the given key was used to fill a note field.
+func (m frontmatter) consume(key string) {
+	if m.consumed != nil {
+		m.consumed[key] = true
+	}
+}
+
+// consumedKeys returns the sorted list of keys used to fill note fields.
+func (m frontmatter) consumedKeys() []string {
+	keys := []string{}
+	for key := range m.consumed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // getString returns the first string value found for any of the given keys.
+// The numbers and booleans nested under a dotted key are converted to
+// strings, e.g. `1` for `meta.a` in `meta: {a: 1}`.
 func (m frontmatter) getString(keys ...string) opt.String {
 	if m.values == nil {
 		return opt.NullString
 	}
 
 	for _, key := range keys {
-		key = strings.ToLower(key)
-		if val, ok := m.values[key]; ok {
-			if val, ok := val.(string); ok {
-				return opt.NewNotEmptyString(val)
+		key = m.key(key)
+		if val, ok := m.lookup(key); ok {
+			str, ok := val.(string)
+			if !ok && strings.Contains(key, ".") {
+				str, ok = scalarString(val)
+			}
+			if ok {
+				// A whitespace-only value is as good as an empty one, so
+				// the next keys are tried.
+				if strings.TrimSpace(str) == "" {
+					continue
+				}
+				m.consume(key)
+				return opt.NewString(str)
 			}
 		}
 	}
 	return opt.NullString
 }
 
+// scalarString converts a scalar frontmatter value to a string.
+func scalarString(val interface{}) (string, bool) {
+	switch val := val.(type) {
+	case int:
+		return strconv.Itoa(val), true
+	case int64:
+		return strconv.FormatInt(val, 10), true
+	case uint64:
+		return strconv.FormatUint(val, 10), true
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(val), true
+	}
+	return "", false
+}
+
+// getValue returns the first non-empty value found for any of the given keys,
+// with its key, whatever its type.
+func (m frontmatter) getValue(keys ...string) (key string, val interface{}, ok bool) {
+	for _, key := range keys {
+		key = m.key(key)
+		if val, ok := m.lookup(key); ok && val != nil {
+			return key, val, true
+		}
+	}
+	return "", nil, false
+}
+
+// getBool returns the first boolean value found for any of the given keys.
+func (m frontmatter) getBool(keys ...string) opt.Bool {
+	if m.values == nil {
+		return opt.NullBool
+	}
+
+	for _, key := range keys {
+		key = m.key(key)
+		if val, ok := m.lookup(key); ok {
+			if val := parseBool(val); !val.IsNull() {
+				m.consume(key)
+				return val
+			}
+		}
+	}
+	return opt.NullBool
+}
+
+// parseBool converts a frontmatter value to a boolean. The YAML 1.1 boolean
+// strings are accepted if they were decoded as strings, e.g. `"yes"`.
+func parseBool(val interface{}) opt.Bool {
+	switch val := val.(type) {
+	case bool:
+		return opt.NewBool(val)
+	case string:
+		switch strings.ToLower(strings.TrimSpace(val)) {
+		case "true", "yes", "on":
+			return opt.True
+		case "false", "no", "off":
+			return opt.False
+		}
+	}
+	return opt.NullBool
+}
+
+// getInt returns the first integer found for any of the given keys.
+func (m frontmatter) getInt(keys ...string) opt.Int {
+	if m.values == nil {
+		return opt.NullInt
+	}
+
+	for _, key := range keys {
+		key = m.key(key)
+		if val, ok := m.lookup(key); ok {
+			switch val := val.(type) {
+			case int:
+				m.consume(key)
+				return opt.NewInt(val)
+			case int64:
+				m.consume(key)
+				return opt.NewInt(int(val))
+			}
+		}
+	}
+	return opt.NullInt
+}
+
+// getTime returns the first date found for any of the given keys, converted
+// with the given parser.
+func (m frontmatter) getTime(parse func(val interface{}) time.Time, keys ...string) time.Time {
+	if m.values == nil {
+		return time.Time{}
+	}
+
+	for _, key := range keys {
+		key = m.key(key)
+		if val, ok := m.lookup(key); ok {
+			if date := parse(val); !date.IsZero() {
+				m.consume(key)
+				return date
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// parseDate converts a frontmatter value to a date, or returns the zero time
+// if it doesn't hold any. The built-in formats are tried first, then the
+// relative dates, the ISO week dates and the custom DateParsers.
+func (p *Parser) parseDate(val interface{}) time.Time {
+	loc := p.options.TimeZone
+	if date := parseTime(val, loc); !date.IsZero() {
+		return date
+	}
+	str, ok := val.(string)
+	if !ok {
+		return time.Time{}
+	}
+
+	str = strings.TrimSpace(str)
+	now := p.options.Now().In(loc)
+	parsers := append([]DateParser{p.parseRelativeDate, parseISOWeekDate}, p.options.DateParsers...)
+	for _, parse := range parsers {
+		if date, ok := parse(str, now, loc); ok {
+			return date
+		}
+	}
+	return time.Time{}
+}
+
+// parseRelativeDate resolves one of the RelativeDates to the start of its
+// day, e.g. `yesterday`.
+func (p *Parser) parseRelativeDate(value string, now time.Time, loc *time.Location) (time.Time, bool) {
+	for token, days := range p.options.RelativeDates {
+		if strings.EqualFold(value, token) {
+			y, m, d := now.Date()
+			return time.Date(y, m, d+days, 0, 0, 0, 0, loc), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// isoWeekDateRegex matches an ISO week date, with an optional weekday, e.g.
+// `2021-W10` or `2021-W10-3`.
+var isoWeekDateRegex = regexp.MustCompile(`^(\d{4})-?W(\d{2})(?:-?([1-7]))?$`)
+
+// parseISOWeekDate resolves an ISO week date to the start of its day, the
+// Monday when the weekday is omitted.
+func parseISOWeekDate(value string, now time.Time, loc *time.Location) (time.Time, bool) {
+	match := isoWeekDateRegex.FindStringSubmatch(value)
+	if match == nil {
+		return time.Time{}, false
+	}
+	year, _ := strconv.Atoi(match[1])
+	week, _ := strconv.Atoi(match[2])
+	weekday := 1
+	if match[3] != "" {
+		weekday, _ = strconv.Atoi(match[3])
+	}
+
+	// The first week of the year is the one holding the 4th of January.
+	jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, loc)
+	monday := 4 - (int(jan4.Weekday())+6)%7
+	date := time.Date(year, time.January, monday+(week-1)*7+weekday-1, 0, 0, 0, 0, loc)
+
+	// Rejects the weeks overflowing into the next year, e.g. `2021-W53`.
+	if y, w := date.ISOWeek(); y != year || w != week {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// timeZoneRegex matches the offset ending a date with a time, e.g.
+// `10:00:00+02:00` or `10:00Z`.
+var timeZoneRegex = regexp.MustCompile(`\d{2}:\d{2}(?::\d{2}(?:[.,]\d+)?)?\s*(?:[zZ]|[+-]\d{2}(?::?\d{2})?)$`)
+
+// parseTime converts a frontmatter value to a date, or returns the zero
+// time if it doesn't hold any. A date without offset is read in loc.
+func parseTime(val interface{}, loc *time.Location) time.Time {
+	switch val := val.(type) {
+	case time.Time:
+		return val
+	case string:
+		if date, err := iso8601.ParseString(val); err == nil {
+			if !timeZoneRegex.MatchString(strings.TrimSpace(val)) {
+				date = time.Date(date.Year(), date.Month(), date.Day(), date.Hour(), date.Minute(), date.Second(), date.Nanosecond(), loc)
+			}
+			return date
+		}
+		// Omitting the `T` is common
+		if date, err := time.ParseInLocation("2006-01-02 15:04:05", val, loc); err == nil {
+			return date
+		}
+		if date, err := time.ParseInLocation("2006-01-02 15:04", val, loc); err == nil {
+			return date
+		}
+	}
+	return time.Time{}
+}
+
+// getMapStrings returns the values of the given subKeys found in a list of
+// maps, e.g. `[{name: a}, {name: b}]`. Scalar items of the list are kept as
+// is. ok is false when the list doesn't contain any map.
+func (m frontmatter) getMapStrings(key string, subKeys []string) (strs []string, ok bool) {
+	if m.values == nil {
+		return nil, false
+	}
+
+	key = m.key(key)
+	val, _ := m.lookup(key)
+	items, isList := val.([]interface{})
+	if !isList {
+		return nil, false
+	}
+
+	strs = []string{}
+	for _, item := range items {
+		var val interface{} = item
+		if item, isMap := item.(map[string]interface{}); isMap {
+			ok = true
+			val = nil
+			for _, subKey := range subKeys {
+				if v, found := item[subKey]; found {
+					val = v
+					break
+				}
+			}
+			if val == nil {
+				continue
+			}
+		}
+		if s := strings.TrimSpace(fmt.Sprint(val)); len(s) > 0 {
+			strs = append(strs, s)
+		}
+	}
+	if !ok {
+		return nil, false
+	}
+	m.consume(key)
+	return strs, true
+}
+
+// getLinkValues returns the links declared for the given key, either as a
+// single value or a list. An unquoted wiki link such as `[[Note]]` is parsed
+// by YAML as nested lists, so it is converted back to a wiki link.
+func (m frontmatter) getLinkValues(key string) []string {
+	// wikiLink returns the wiki link parsed as nested lists, if any.
+	wikiLink := func(val interface{}) (string, bool) {
+		if outer, ok := val.([]interface{}); ok && len(outer) == 1 {
+			if inner, ok := outer[0].([]interface{}); ok && len(inner) == 1 {
+				if target, ok := inner[0].(string); ok {
+					return "[[" + target + "]]", true
+				}
+			}
+		}
+		return "", false
+	}
+
+	key = m.key(key)
+	values := []string{}
+	val, _ := m.lookup(key)
+	switch val := val.(type) {
+	case string:
+		values = append(values, val)
+	case []interface{}:
+		if link, ok := wikiLink(val); ok {
+			values = append(values, link)
+			break
+		}
+		for _, item := range val {
+			if value, ok := item.(string); ok {
+				values = append(values, value)
+			} else if link, ok := wikiLink(item); ok {
+				values = append(values, link)
+			}
+		}
+	default:
+		return values
+	}
+	m.consume(key)
+	return values
+}
+
 // getStrings returns the first string list found for any of the given keys.
 func (m frontmatter) getStrings(keys ...string) ([]string, bool) {
 	if m.values == nil {
@@ -356,8 +3246,8 @@ func (m frontmatter) getStrings(keys ...string) ([]string, bool) {
 	}
 
 	for _, key := range keys {
-		key = strings.ToLower(key)
-		if val, ok := m.values[key]; ok {
+		key = m.key(key)
+		if val, ok := m.lookup(key); ok {
 			if val, ok := val.([]interface{}); ok {
 				strs := []string{}
 				for _, v := range val {
@@ -366,6 +3256,7 @@ func (m frontmatter) getStrings(keys ...string) ([]string, bool) {
 						strs = append(strs, s)
 					}
 				}
+				m.consume(key)
 				return strs, true
 			}
 		}
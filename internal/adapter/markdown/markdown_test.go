@@ -1,8 +1,17 @@
 package markdown
 
 import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/yuin/goldmark/ast"
+	goldparser "github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/zk-org/zk/internal/adapter/markdown/extensions"
 	"github.com/zk-org/zk/internal/core"
 	"github.com/zk-org/zk/internal/util"
 	"github.com/zk-org/zk/internal/util/opt"
@@ -42,6 +51,50 @@ title: lowercase key
 ---
 Paragraph
 `, "lowercase key")
+
+	// Empty headings are skipped.
+	test("#\n\n## A title", "A title")
+	test("# ![](image.png)\n\n## A title", "A title")
+
+	// Multi-line setext heading
+	test("Part one\npart *two*\n===\n\nBody", "Part one part two")
+	test("  Part one\n  part two\n  ---\nBody", "Part one part two")
+	// ATX headings can't span several lines, the continuation is a paragraph.
+	test("# Part one\n  part two\n\nBody", "Part one")
+
+	// Falls back on the heading when the frontmatter title is blank.
+	test("---\ntitle: \"\"\n---\n\n# Heading", "Heading")
+	test("---\ntitle: \"   \"\n---\n\n# Heading", "Heading")
+	test("---\ntitle: \"\\t\\n\"\n---\n\n# Heading", "Heading")
+}
+
+func TestParseRawTitle(t *testing.T) {
+	test := func(source string, expectedTitle string, expectedRawTitle string) {
+		content := parse(t, source)
+		assert.Equal(t, content.Title, opt.NewNotEmptyString(expectedTitle))
+		assert.Equal(t, content.RawTitle, opt.NewNotEmptyString(expectedRawTitle))
+	}
+
+	test("", "", "")
+	test("# A title", "A title", "A title")
+	test("# An *emphasized* __title__ #", "An emphasized title", "An *emphasized* __title__")
+	test("# A [link](http://stripped) and `code`", "A link and code", "A [link](http://stripped) and `code`")
+	test("Part one\npart *two*\n===\n\nBody", "Part one part two", "Part one part *two*")
+	test("---\ntitle: A *title*\n---\n\n# Heading", "A *title*", "A *title*")
+}
+
+func TestParseBodyTitle(t *testing.T) {
+	test := func(source string, expectedTitle string, expectedBodyTitle string) {
+		content := parse(t, source)
+		assert.Equal(t, content.Title, opt.NewNotEmptyString(expectedTitle))
+		assert.Equal(t, content.BodyTitle, opt.NewNotEmptyString(expectedBodyTitle))
+	}
+
+	test("", "", "")
+	test("## Heading 2", "Heading 2", "")
+	test("## Heading 2\n\n# Heading 1", "Heading 1", "Heading 1")
+	test("# First\n\n# Second", "First", "First")
+	test("---\ntitle: From frontmatter\n---\n\n# From *heading*", "From frontmatter", "From heading")
 }
 
 func TestParseBody(t *testing.T) {
@@ -50,6 +103,15 @@ func TestParseBody(t *testing.T) {
 		assert.Equal(t, content.Body, opt.NewNotEmptyString(expectedBody))
 	}
 
+	test("#\n## A title\nBody", "Body")
+	test("Paragraph\n\n#\n\nBody", "Paragraph\n\n#\n\nBody")
+
+	// The heading markup is not part of the body.
+	test("Part one\npart two\n===\n\nBody", "Body")
+	test("Title\n---\n---\nBody", "---\nBody")
+	test("# Title #\n\nBody", "Body")
+	test("# Part one\n  part two\n\nBody", "part two\n\nBody")
+
 	test("", "")
 	test("# A title\n    \n", "")
 	test("Paragraph \n\n# A title", "")
@@ -88,6 +150,253 @@ Paragraph
 `, "Paragraph")
 }
 
+func TestParseHeadings(t *testing.T) {
+	content := parse(t, `# A title
+
+## Section *one*
+
+`+"```"+`
+# Not a heading
+`+"```"+`
+
+### Sub-section
+`)
+	assert.Equal(t, content.Headings, []core.Heading{
+		{Level: 1, Text: "A title", Anchor: "a-title"},
+		{Level: 2, Text: "Section one", Anchor: "section-one"},
+		{Level: 3, Text: "Sub-section", Anchor: "sub-section"},
+	})
+}
+
+func TestParseHeadingsWordCount(t *testing.T) {
+	content := parse(t, `# A title
+
+An introduction.
+
+## Section one
+
+Three *emphasized* words.
+
+`+"```"+`
+code is not counted
+`+"```"+`
+
+### Sub-section
+
+- One item
+- and `+"`code`"+`
+
+## Section two
+
+> Quoted words count too.
+`)
+	assert.Equal(t, content.Headings, []core.Heading{
+		{Level: 1, Text: "A title", Anchor: "a-title", WordCount: 13},
+		{Level: 2, Text: "Section one", Anchor: "section-one", WordCount: 7},
+		{Level: 3, Text: "Sub-section", Anchor: "sub-section", WordCount: 4},
+		{Level: 2, Text: "Section two", Anchor: "section-two", WordCount: 4},
+	})
+}
+
+func TestParseHeadingsWithMaxDepth(t *testing.T) {
+	source := "## First\n\n#### Level 4\n\n### Level 3\n\n# Level 1\n\n#### Level 4 again"
+
+	content := parseWithOptions(t, source, ParserOpts{MaxHeadingDepth: 3})
+	assert.Equal(t, content.Title, opt.NewString("Level 1"))
+	assert.Equal(t, content.Headings, []core.Heading{
+		{Level: 2, Text: "First", Anchor: "first"},
+		{Level: 3, Text: "Level 3", Anchor: "level-3"},
+		{Level: 1, Text: "Level 1", Anchor: "level-1"},
+	})
+
+	content = parseWithOptions(t, source, ParserOpts{})
+	assert.Equal(t, len(content.Headings), 5)
+}
+
+func TestParseHeadingsWithTOCDisabled(t *testing.T) {
+	test := func(frontmatter string, options ParserOpts, expected []core.Heading) {
+		content := parseWithOptions(t, "---\n"+frontmatter+"\n---\n\n# A title\n\n## Section", options)
+		assert.Equal(t, content.Title, opt.NewString("A title"))
+		assert.Equal(t, content.BodyTitle, opt.NewString("A title"))
+		assert.Equal(t, content.Headings, expected)
+	}
+
+	headings := []core.Heading{
+		{Level: 1, Text: "A title", Anchor: "a-title"},
+		{Level: 2, Text: "Section", Anchor: "section"},
+	}
+
+	test("author: Alice", ParserOpts{}, headings)
+	test("toc: true", ParserOpts{}, headings)
+	test("toc: false", ParserOpts{}, []core.Heading{})
+	test("outline: false", ParserOpts{TOCKeys: []string{"outline"}}, []core.Heading{})
+}
+
+func TestParseHeadingsWithSlugStyle(t *testing.T) {
+	test := func(style SlugStyle, heading string, expected string) {
+		content := parseWithOptions(t, "# "+heading, ParserOpts{SlugStyle: style})
+		assert.Equal(t, content.Headings[0].Anchor, expected)
+	}
+
+	heading := "Foo, Bar: Élan  & Co_op #1?"
+	test("", heading, "foo-bar-élan---co_op-1")
+	test(SlugStyleGitHub, heading, "foo-bar-élan---co_op-1")
+	test(SlugStyleObsidian, heading, "Foo, Bar Élan & Co_op 1?")
+	test(SlugStylePlain, heading, "foo-bar-elan-and-co_op-1")
+}
+
+func TestParseLeadFromFrontmatter(t *testing.T) {
+	test := func(source string, options ParserOpts, expectedLead string, expectedRest string) {
+		content := parseWithOptions(t, source, options)
+		assert.Equal(t, content.Lead, opt.NewNotEmptyString(expectedLead))
+		assert.Equal(t, content.Rest, opt.NewNotEmptyString(expectedRest))
+	}
+
+	test(`---
+abstract: |
+  First paragraph
+  of the abstract.
+
+  Second paragraph.
+---
+
+# Title
+
+Body
+`, ParserOpts{}, "First paragraph\nof the abstract.\n\nSecond paragraph.", "Body")
+
+	test(`---
+abstract: >
+  Folded
+  abstract.
+---
+
+# Title
+
+Body
+`, ParserOpts{}, "Folded abstract.", "Body")
+
+	test("---\nsummary: A summary\nabstract: An abstract\n---\n\n# Title\n\nBody", ParserOpts{
+		LeadKeys: []string{"summary"},
+	}, "A summary", "Body")
+	test("---\nabstract: An abstract\n---\n\n# Title\n\nBody\n\nRest", ParserOpts{
+		LeadKeys: []string{},
+	}, "Body", "Rest")
+}
+
+func TestParseLeadWithMarkers(t *testing.T) {
+	test := func(source string, markers []string, expectedLead string, expectedRest string) {
+		content := parseWithOptions(t, source, ParserOpts{LeadMarkers: markers})
+		assert.Equal(t, content.Lead, opt.NewNotEmptyString(expectedLead))
+		assert.Equal(t, content.Rest, opt.NewNotEmptyString(expectedRest))
+	}
+
+	markers := []string{"<!--more-->", "{{< more >}}"}
+
+	test("# Title\n\nFirst\n\nSecond", markers, "First", "Second")
+	test("# Title\n\nFirst\n\nSecond\n\n{{< more >}}\n\nRest", markers, "First\n\nSecond", "Rest")
+	test("# Title\n\nFirst\n<!--more-->\nSecond\n\n{{< more >}}\n\nRest", markers, "First", "Second\n\n{{< more >}}\n\nRest")
+	test("# Title\n\nFirst\n{{< more >}}\nSecond\n\n<!--more-->\n\nRest", markers, "First", "Second\n\n<!--more-->\n\nRest")
+	test("# Title\n\nFirst\n\n<!--more-->", markers, "First", "")
+	// The markers are disabled by default.
+	test("# Title\n\nFirst\nSecond\n\n<!--more-->\n\nRest", nil, "First\nSecond", "<!--more-->\n\nRest")
+
+	// The markers written in code are ignored.
+	test("# T\n\n```\n<!--more-->\n```\n\nPara", markers, "```\n<!--more-->\n```", "Para")
+	test("# T\n\nFirst\n\n    <!--more-->\n\nPara", markers, "First", "<!--more-->\n\nPara")
+	test("# T\n\nThe `<!--more-->` marker\n\n<!--more-->\n\nRest", markers, "The `<!--more-->` marker", "Rest")
+	test("# T\n\n> <!--more-->\n\nPara\n\nRest", markers, "> <!--more-->", "Para\n\nRest")
+}
+
+func TestParseLeadDedupedFromTitle(t *testing.T) {
+	test := func(source string, dedupe bool, expectedLead string, expectedRest string) {
+		content := parseWithOptions(t, source, ParserOpts{DedupeTitleLead: dedupe})
+		assert.Equal(t, content.Lead, opt.NewNotEmptyString(expectedLead))
+		assert.Equal(t, content.Rest, opt.NewNotEmptyString(expectedRest))
+	}
+
+	source := "---\ntitle: A note\n---\n\n*A note*\n\nSecond\n\nThird"
+	test(source, false, "*A note*", "Second\n\nThird")
+	test(source, true, "Second", "Third")
+	test("---\ntitle: A note\n---\n\nA note", true, "", "")
+	// Different title and opening paragraph.
+	test("---\ntitle: A note\n---\n\nFirst\n\nSecond", true, "First", "Second")
+	test("# A note\n\nA note, but longer\n\nSecond", true, "A note, but longer", "Second")
+}
+
+func TestParseRest(t *testing.T) {
+	test := func(source string, expectedLead string, expectedRest string) {
+		content := parse(t, source)
+		assert.Equal(t, content.Lead, opt.NewNotEmptyString(expectedLead))
+		assert.Equal(t, content.Rest, opt.NewNotEmptyString(expectedRest))
+	}
+
+	test("", "", "")
+	test("# Title", "", "")
+	test("# Title\n\nSingle paragraph\non two lines\n", "Single paragraph\non two lines", "")
+	test(`# Title
+
+Lead paragraph
+
+Second paragraph
+
+## Section
+
+Third paragraph
+`, "Lead paragraph", "Second paragraph\n\n## Section\n\nThird paragraph")
+	test("# Title\n\n```\nCode\n\nblock\n```\nParagraph\n\nRest", "```\nCode\n\nblock\n```\nParagraph", "Rest")
+}
+
+func TestParseSections(t *testing.T) {
+	test := func(source string, expected []string) {
+		content := parse(t, source)
+		texts := []string{}
+		for _, section := range content.Sections {
+			assert.Equal(t, source[section.Start:section.End], section.Text)
+			texts = append(texts, section.Text)
+		}
+		assert.Equal(t, texts, expected)
+	}
+
+	test("", []string{})
+	test("# Title", []string{})
+	test("# Title\n\nParagraph", []string{"Paragraph"})
+	test(`# Title
+
+Morning
+
+---
+
+Afternoon
+on two lines
+
+* * *
+
+Evening
+`, []string{"Morning", "Afternoon\non two lines", "Evening"})
+
+	// The frontmatter and the breaks before the title are not sections
+	// delimiters.
+	test(`---
+title: Daily
+---
+
+Morning
+---
+Afternoon
+
+---
+
+Evening`, []string{"Morning\n---\nAfternoon", "Evening"})
+	test("* * *\n\n# Title\n\nMorning\n\n---\n\nEvening\n\n***\n", []string{"Morning", "Evening"})
+
+	// Breaks nested in other blocks or in code are ignored.
+	test("# Title\n\n> Quote\n>\n> ---\n\n```\n---\n```\n\n---\n\nEnd", []string{
+		"> Quote\n>\n> ---\n\n```\n---\n```",
+		"End",
+	})
+}
+
 func TestParseLead(t *testing.T) {
 	test := func(source string, expectedLead string) {
 		content := parse(t, source)
@@ -152,6 +461,277 @@ Paragraph`,
 		`* item1
 * item2`,
 	)
+
+	// Blank lines inside a block don't end the lead.
+	test(
+		"# A title\n\n```\ncode\n\nblock\n```\n\nParagraph",
+		"```\ncode\n\nblock\n```",
+	)
+}
+
+func TestParseLeadMatchesScanner(t *testing.T) {
+	test := func(source string, expectedLead string, expectedRest string) {
+		content := parse(t, source)
+		assert.Equal(t, content.Lead, opt.NewNotEmptyString(expectedLead))
+		assert.Equal(t, content.Rest, opt.NewNotEmptyString(expectedRest))
+		// The line-based scanner agrees on blocks without inner blank lines.
+		assert.Equal(t, content.Lead, parseLeadWithScanner(content.Body))
+	}
+
+	// A thematic break is a lead on its own.
+	test("# T\n\n---\n\nPara", "---", "Para")
+	test("# T\n\n***\n***\n\nPara", "***\n***", "Para")
+	test("---\ntitle: T\n---\n\n***\n\nPara", "***", "Para")
+	// A loose list ends the lead before the item separated by a blank line.
+	test("# T\n\n- a\n- b\n\n- c", "- a\n- b", "- c")
+	test("# T\n\n- a\n\n  more\n- b", "- a", "more\n- b")
+	// An indented code block ends the lead at its first blank line.
+	test("# T\n\n    code\n\n    block\n\nPara", "code", "block\n\nPara")
+}
+
+func TestParseVeryLongLine(t *testing.T) {
+	// bufio.Scanner's default buffer is limited to 64 KB lines.
+	line := strings.Repeat("A very long minified line. ", 4000)
+	assert.True(t, len(line) > 100*1000)
+
+	content := parse(t, line)
+	assert.Equal(t, content.Title, opt.NullString)
+	assert.Equal(t, content.Body, opt.NewString(strings.TrimSpace(line)))
+	assert.Equal(t, content.Lead, opt.NewString(strings.TrimSpace(line)))
+
+	content = parse(t, "# Title\n"+line)
+	assert.Equal(t, content.Title, opt.NewString("Title"))
+	assert.Equal(t, content.Lead, opt.NewString(strings.TrimSpace(line)))
+}
+
+// parseLeadWithScanner is the former line-based implementation of parseLead,
+// kept to compare its performance with the AST-based one.
+func parseLeadWithScanner(body opt.String) opt.String {
+	lead := ""
+	scanner := bufio.NewScanner(strings.NewReader(body.String()))
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			break
+		}
+		lead += scanner.Text() + "\n"
+	}
+
+	return opt.NewNotEmptyString(strings.TrimSpace(lead))
+}
+
+func BenchmarkParseLead(b *testing.B) {
+	paragraph := strings.Repeat("A line of a rather long lead paragraph.\n", 200)
+	source := []byte("# A title\n\n" + strings.Repeat(paragraph+"\n", 50))
+
+	parser := NewParser(ParserOpts{}, &util.NullLogger)
+	root := parser.md.Parser().Parse(text.NewReader(source))
+	_, _, bodyStart, err := parseTitle(frontmatter{}, root, source)
+	if err != nil {
+		b.Fatal(err)
+	}
+	body := parseBody(bodyStart, source)
+
+	b.Run("scanner", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			parseLeadWithScanner(body)
+		}
+	})
+
+	b.Run("ast", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			parseLead(root, bodyStart, source)
+		}
+	})
+}
+
+func TestParseTagsOnly(t *testing.T) {
+	parser := NewParser(ParserOpts{
+		HashtagEnabled:      true,
+		MultiWordTagEnabled: true,
+		ColontagEnabled:     true,
+	}, &util.NullLogger)
+
+	test := func(source string, expected []string) {
+		tags, err := parser.ParseTags(source)
+		assert.Nil(t, err)
+		assert.Equal(t, tags, expected)
+
+		content, err := parser.ParseNoteContent(source)
+		assert.Nil(t, err)
+		assert.Equal(t, tags, content.Tags)
+	}
+
+	test("", []string{})
+	test("# Title\n\nA #hashtag and a :colon:tag:", []string{"hashtag", "colon", "tag"})
+	test("---\ntags: [one, \"#two\"]\nkeywords: three four\n---\n\nA #hashtag #one", []string{"one", "two", "three", "four", "hashtag"})
+	test("---yaml\ntags: [one]\n...\n\nA #multi word# tag", []string{"one", "multi word"})
+	// Tags in code are ignored.
+	test("A `#code` tag\n\n```\n#code\n```\n\n    #indented", []string{})
+}
+
+func BenchmarkParseTags(b *testing.B) {
+	source := "---\ntags: [one, two]\n---\n\n# Title\n\n" +
+		strings.Repeat("A paragraph with a #hashtag and a [[link]].\n\n", 500)
+	parser := NewParser(ParserOpts{HashtagEnabled: true}, &util.NullLogger)
+
+	b.Run("ParseTags", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			parser.ParseTags(source)
+		}
+	})
+
+	b.Run("ParseNoteContent", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			parser.ParseNoteContent(source)
+		}
+	})
+}
+
+// benchmarkNote returns a note of roughly the given size in bytes, with a
+// frontmatter, headings, tags and links.
+func benchmarkNote(size int) string {
+	section := "## A section\n\n" +
+		"A paragraph with a #hashtag, a [[wiki link]] and a [regular link](https://example.com).\n" +
+		"It goes on with a second line of *emphasized* text.\n\n" +
+		"- A list item\n- Another item with `code`\n\n"
+	return "---\ntitle: A note\ntags: [one, two]\n---\n\n# A note\n\n" +
+		strings.Repeat(section, size/len(section)+1)
+}
+
+func BenchmarkParseNoteContent(b *testing.B) {
+	parser := NewParser(ParserOpts{HashtagEnabled: true}, &util.NullLogger)
+	sizes := []struct {
+		name string
+		size int
+	}{
+		{"small", 1 << 10},
+		{"medium", 32 << 10},
+		{"large", 1 << 20},
+	}
+
+	for _, size := range sizes {
+		source := benchmarkNote(size.size)
+		b.Run(size.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(source)))
+			for i := 0; i < b.N; i++ {
+				parser.ParseNoteContent(source)
+			}
+		})
+	}
+}
+
+func BenchmarkParseBody(b *testing.B) {
+	source := []byte("# Title\n\n" + benchmarkNote(1<<20) + "\n\n")
+	b.ReportAllocs()
+	b.SetBytes(int64(len(source)))
+	for i := 0; i < b.N; i++ {
+		parseBody(9, source)
+	}
+}
+
+func TestParseDoesNotMutateSource(t *testing.T) {
+	// Triggers the normalization of the fences.
+	content := "---yaml\ntitle: A note\ntags: [one]\n...\n\n# Heading\n\n" +
+		"A #tag, a ［［fullwidth link］］ and a [[wiki link]].\n\n<!--more-->\n\n> A quote\n\n    code\n"
+	parser := NewParser(ParserOpts{
+		HashtagEnabled:     true,
+		LenientFrontmatter: true,
+		LeadMarkers:        []string{"<!--more-->"},
+	}, &util.NullLogger)
+
+	// Runs the helpers reading the source, which must be left untouched.
+	test := func(source []byte, fence frontmatterFence) {
+		original := append([]byte{}, source...)
+
+		context := goldparser.NewContext()
+		root := parser.md.Parser().Parse(text.NewReader(source), goldparser.WithContext(context))
+		_, err := parser.walkAST(root, source)
+		assert.Nil(t, err)
+		frontmatter, err := parseFrontmatter(context, source, fence, false, true)
+		assert.Nil(t, err)
+		_, _, bodyStart, err := parseTitle(frontmatter, root, source)
+		assert.Nil(t, err)
+		parseBody(bodyStart, source)
+		parseLead(root, bodyStart, source)
+		parser.findLeadMarker(root, source, bodyStart)
+		plainBody(root, source, bodyStart, PlainOpts{KeepHeadings: true, KeepCode: true})
+		walkProseLines(root, source, func(line string, start int) {})
+
+		assert.Equal(t, source, original)
+	}
+
+	raw := []byte(content)
+	original := append([]byte{}, raw...)
+	fenced, _ := normalizeFrontmatterFences(raw)
+	assert.Equal(t, raw, original)
+	assert.False(t, bytes.Equal(fenced, raw))
+
+	test(raw, frontmatterFence{})
+	source, fence := parser.prepareSource(content)
+	assert.Equal(t, source, fenced)
+	test(source, fence)
+}
+
+func TestParseWikiLinkTags(t *testing.T) {
+	test := func(source string, enabled bool, expectedTags []string, expectedHrefs []string) {
+		content := parseWithOptions(t, source, ParserOpts{
+			HashtagEnabled:     true,
+			WikiLinkTagEnabled: enabled,
+		})
+		assert.Equal(t, content.Tags, expectedTags)
+		hrefs := []string{}
+		for _, link := range content.Links {
+			hrefs = append(hrefs, link.Href)
+		}
+		assert.Equal(t, hrefs, expectedHrefs)
+	}
+
+	source := "An [[#idea]], a [[ #a/b | nested tag ]], a #hashtag and a [[link]]."
+	test(source, true, []string{"idea", "a/b", "hashtag"}, []string{"link"})
+	test(source, false, []string{"hashtag"}, []string{"#idea", "#a/b", "link"})
+	test("An empty [[#]] tag", true, []string{}, []string{"#"})
+}
+
+func TestParseTagsWithFilters(t *testing.T) {
+	test := func(options ParserOpts, expected []string) {
+		options.HashtagEnabled = true
+		options.ColontagEnabled = true
+		content := parseWithOptions(t, "---\ntags: [x, '2']\n---\n\n#1 #a #ab #été :42:b:", options)
+		assert.Equal(t, content.Tags, expected)
+	}
+
+	test(ParserOpts{}, []string{"x", "2", "a", "ab", "été", "42", "b"})
+	test(ParserOpts{MinTagLength: 1}, []string{"x", "2", "a", "ab", "été", "42", "b"})
+	// Frontmatter tags are never filtered.
+	test(ParserOpts{MinTagLength: 2}, []string{"x", "2", "ab", "été", "42"})
+	test(ParserOpts{MinTagLength: 3}, []string{"x", "2", "été"})
+	test(ParserOpts{DropNumericTags: true}, []string{"x", "2", "a", "ab", "été", "b"})
+	test(ParserOpts{MinTagLength: 2, DropNumericTags: true}, []string{"x", "2", "ab", "été"})
+}
+
+func TestWalkInline(t *testing.T) {
+	source := "# Title\n\nA [link](target), a *[[wiki link]]* and `[code](url)`.\n\n> [Quoted](quoted) [[last]]"
+	parser := NewParser(ParserOpts{}, &util.NullLogger)
+
+	walkLinks := func(limit int) []string {
+		links := []string{}
+		err := parser.WalkInline(source, func(n ast.Node) bool {
+			switch link := n.(type) {
+			case *ast.Link:
+				links = append(links, string(link.Destination))
+			case *extensions.WikiLink:
+				links = append(links, string(link.Destination))
+			}
+			return len(links) < limit
+		})
+		assert.Nil(t, err)
+		return links
+	}
+
+	assert.Equal(t, walkLinks(10), []string{"target", "wiki link", "quoted", "last"})
+	// Stops when the callback returns false.
+	assert.Equal(t, walkLinks(2), []string{"target", "wiki link"})
 }
 
 func TestParseHashtags(t *testing.T) {
@@ -173,6 +753,9 @@ func TestParseHashtags(t *testing.T) {
 	test("#multiple#hashtags", []string{})
 	// Unicode hashtags
 	test("#libellé-français, #日本語ハッシュタグ", []string{"libellé-français", "日本語ハッシュタグ"})
+	test("#café #日本語 #naïve", []string{"café", "日本語", "naïve"})
+	// Combining marks, e.g. a decomposed accent or a Devanagari vowel sign.
+	test("#cafe\u0301 #nai\u0308ve #हिन्दी", []string{"cafe\u0301", "nai\u0308ve", "हिन्दी"})
 	// Punctuation breaking tags
 	test(
 		"#a #b, #c; #d. #e! #f? #g* #h\", #i(, #j), #k[, #l], #m{, #n}",
@@ -213,6 +796,9 @@ func TestParseWordtags(t *testing.T) {
 	test("#multiple#hashtags", []string{"multiple"})
 	// Unicode hashtags
 	test("#libellé-français, #日本語ハッシュタグ", []string{"libellé-français", "日本語ハッシュタグ"})
+	test("#café #日本語 #naïve", []string{"café", "日本語", "naïve"})
+	// Combining marks, e.g. a decomposed accent or a Devanagari vowel sign.
+	test("#cafe\u0301 #nai\u0308ve #हिन्दी", []string{"cafe\u0301", "nai\u0308ve", "हिन्दी"})
 	// Punctuation breaking tags
 	test(
 		"#a #b, #c; #d. #e! #f? #g* #h\", #i(, #j), #k[, #l], #m{, #n}",
@@ -266,6 +852,7 @@ func TestParseColontags(t *testing.T) {
 	test(":multiple :colontags:", []string{"colontags"})
 	// Unicode colontags
 	test(":libellé-français:日本語ハッシュタグ:", []string{"libellé-français", "日本語ハッシュタグ"})
+	test(":cafe\u0301:हिन्दी:", []string{"cafe\u0301", "हिन्दी"})
 	// Punctuation is not allowed
 	test(":a : :b,: :c;: :d.: :e!: :f?: :g*: :h\": :i(: :j): :k[: :l]: :m{: :n}:", []string{})
 	// Authorized special characters
@@ -336,6 +923,73 @@ Body
 `, []string{"tag1", "tag-2", "kw1", "kw2", "kw3"})
 }
 
+func TestParseTagsFromFrontmatterMaps(t *testing.T) {
+	test := func(opts ParserOpts, source string, tags []string) {
+		content := parseWithOptions(t, source, opts)
+		assert.Equal(t, content.Tags, tags)
+	}
+
+	test(ParserOpts{}, `---
+tags:
+  - name: work
+  - name: "#urgent"
+    color: red
+  - color: blue
+  - scalar
+---
+
+Body
+`, []string{"work", "urgent", "scalar"})
+
+	test(ParserOpts{TagSubKeys: []string{"label", "name"}}, `---
+keywords:
+  - label: one
+    name: ignored
+  - name: two
+---
+
+Body
+`, []string{"one", "two"})
+
+	// Plain lists and strings are still supported.
+	test(ParserOpts{}, `---
+tags: [tag1, tag2]
+keywords: kw1 kw2
+---
+
+Body
+`, []string{"tag1", "tag2", "kw1", "kw2"})
+}
+
+func TestParseKeywords(t *testing.T) {
+	test := func(frontmatter string, keywords []core.Keyword, tags []string) {
+		content := parse(t, "---\n"+frontmatter+"\n---\n# Title")
+		assert.Equal(t, content.Keywords, keywords)
+		assert.Equal(t, content.Tags, tags)
+	}
+
+	test("title: Title", []core.Keyword{}, []string{})
+	test("keywords: [go:2, testing:1, \"#search:0.5\"]", []core.Keyword{
+		{Term: "go", Weight: 2},
+		{Term: "testing", Weight: 1},
+		{Term: "search", Weight: 0.5},
+	}, []string{"go", "testing", "search"})
+	test("keywords: [go, testing, go]", []core.Keyword{
+		{Term: "go", Weight: 1},
+		{Term: "testing", Weight: 1},
+	}, []string{"go", "testing"})
+	test("keyword: go:3 testing", []core.Keyword{
+		{Term: "go", Weight: 3},
+		{Term: "testing", Weight: 1},
+	}, []string{"go", "testing"})
+	test("keywords:\n  - go: 2\n  - testing", []core.Keyword{
+		{Term: "go", Weight: 2},
+		{Term: "testing", Weight: 1},
+	}, []string{"testing"})
+	// Only keywords are weighted.
+	test("tags: [c:2]", []core.Keyword{}, []string{"c:2"})
+}
+
 func TestParseTagsIgnoresDuplicates(t *testing.T) {
 	test := func(source string, tags []string) {
 		content := parse(t, source)
@@ -392,6 +1046,7 @@ Neuron links with titles: [[trailing|Trailing link]]# #[[leading |  Leading link
 			Snippet:      "Heading with a [link](heading)",
 			SnippetStart: 3,
 			SnippetEnd:   33,
+			Target:       "heading",
 		},
 		{
 			Title:      "multiple links",
@@ -403,6 +1058,7 @@ Neuron links with titles: [[trailing|Trailing link]]# #[[leading |  Leading link
 A link can have [one relation](one "rel-1") or [several relations](several "rel-1 rel-2").`,
 			SnippetStart: 35,
 			SnippetEnd:   222,
+			Target:       "stripped-formatting",
 		},
 		{
 			Title:      "relative",
@@ -414,6 +1070,7 @@ A link can have [one relation](one "rel-1") or [several relations](several "rel-
 A link can have [one relation](one "rel-1") or [several relations](several "rel-1 rel-2").`,
 			SnippetStart: 35,
 			SnippetEnd:   222,
+			Target:       "../other",
 		},
 		{
 			Title:      "one relation",
@@ -425,6 +1082,7 @@ A link can have [one relation](one "rel-1") or [several relations](several "rel-
 A link can have [one relation](one "rel-1") or [several relations](several "rel-1 rel-2").`,
 			SnippetStart: 35,
 			SnippetEnd:   222,
+			Target:       "one",
 		},
 		{
 			Title:      "several relations",
@@ -436,6 +1094,7 @@ A link can have [one relation](one "rel-1") or [several relations](several "rel-
 A link can have [one relation](one "rel-1") or [several relations](several "rel-1 rel-2").`,
 			SnippetStart: 35,
 			SnippetEnd:   222,
+			Target:       "several",
 		},
 		{
 			Title:        "https://inline-link.com",
@@ -466,6 +1125,7 @@ A link can have [one relation](one "rel-1") or [several relations](several "rel-
 			Snippet:      "A [[Wiki link]] is surrounded by [[2-brackets | two brackets]].",
 			SnippetStart: 288,
 			SnippetEnd:   351,
+			Target:       "Wiki link",
 		},
 		{
 			Title:        "two brackets",
@@ -476,6 +1136,7 @@ A link can have [one relation](one "rel-1") or [several relations](several "rel-
 			Snippet:      "A [[Wiki link]] is surrounded by [[2-brackets | two brackets]].",
 			SnippetStart: 288,
 			SnippetEnd:   351,
+			Target:       "2-brackets",
 		},
 		{
 			Title:        "lien accentué",
@@ -486,6 +1147,7 @@ A link can have [one relation](one "rel-1") or [several relations](several "rel-
 			Snippet:      "[[lien accentué]]",
 			SnippetStart: 353,
 			SnippetEnd:   371,
+			Target:       "lien accentué",
 		},
 		{
 			Title:        `esca]]ped [chara\cters`,
@@ -496,6 +1158,7 @@ A link can have [one relation](one "rel-1") or [several relations](several "rel-
 			Snippet:      `It can contain [[esca]\]ped \[chara\\cters]].`,
 			SnippetStart: 373,
 			SnippetEnd:   418,
+			Target:       `esca]]ped [chara\cters`,
 		},
 		{
 			Title:        "Folgezettel link",
@@ -506,6 +1169,7 @@ A link can have [one relation](one "rel-1") or [several relations](several "rel-
 			Snippet:      "A [[[Folgezettel link]]] is surrounded by three brackets.",
 			SnippetStart: 420,
 			SnippetEnd:   477,
+			Target:       "Folgezettel link",
 		},
 		{
 			Title:        "trailing hash",
@@ -516,6 +1180,7 @@ A link can have [one relation](one "rel-1") or [several relations](several "rel-
 			Snippet:      "Neuron also supports a [[trailing hash]]# for Folgezettel links.",
 			SnippetStart: 479,
 			SnippetEnd:   543,
+			Target:       "trailing hash",
 		},
 		{
 			Title:        "leading hash",
@@ -526,6 +1191,7 @@ A link can have [one relation](one "rel-1") or [several relations](several "rel-
 			Snippet:      "A #[[leading hash]] is used for #uplinks.",
 			SnippetStart: 545,
 			SnippetEnd:   586,
+			Target:       "leading hash",
 		},
 		{
 			Title:        "Trailing link",
@@ -536,6 +1202,7 @@ A link can have [one relation](one "rel-1") or [several relations](several "rel-
 			Snippet:      "Neuron links with titles: [[trailing|Trailing link]]# #[[leading |  Leading link]]",
 			SnippetStart: 588,
 			SnippetEnd:   670,
+			Target:       "trailing",
 		},
 		{
 			Title:        "Leading link",
@@ -546,6 +1213,7 @@ A link can have [one relation](one "rel-1") or [several relations](several "rel-
 			Snippet:      "Neuron links with titles: [[trailing|Trailing link]]# #[[leading |  Leading link]]",
 			SnippetStart: 588,
 			SnippetEnd:   670,
+			Target:       "leading",
 		},
 		{
 			Title:        "External links",
@@ -581,6 +1249,7 @@ A link can have [one relation](one "rel-1") or [several relations](several "rel-
 			Snippet:      "[foo%20bar](202110031652%20foo%20bar)",
 			SnippetStart: 0,
 			SnippetEnd:   37,
+			Target:       "202110031652 foo bar",
 		},
 	})
 	test("[[202110031652%20foo%20bar]]", []core.Link{
@@ -593,48 +1262,1902 @@ A link can have [one relation](one "rel-1") or [several relations](several "rel-
 			Snippet:      "[[202110031652%20foo%20bar]]",
 			SnippetStart: 0,
 			SnippetEnd:   28,
+			Target:       "202110031652%20foo%20bar",
 		},
 	})
 }
 
-func TestParseMetadataFromFrontmatter(t *testing.T) {
-	test := func(source string, expectedMetadata map[string]interface{}) {
+func TestParseLinkTargets(t *testing.T) {
+	test := func(source string, title string, href string, target string, ext string, fragment string) {
 		content := parse(t, source)
-		assert.Equal(t, content.Metadata, expectedMetadata)
+		assert.Equal(t, len(content.Links), 1)
+		link := content.Links[0]
+		assert.Equal(t, link.Title, title)
+		assert.Equal(t, link.Href, href)
+		assert.Equal(t, link.Target, target)
+		assert.Equal(t, link.Ext, ext)
+		assert.Equal(t, link.Fragment, fragment)
 	}
 
-	test("", map[string]interface{}{})
-	test("# A title", map[string]interface{}{})
-	test("---\n---\n# A title", map[string]interface{}{})
-	test(`---
-title: A title
-tags:
-  - tag1
-  - "tag 2"
-nested:
-  key: value
----
+	test("[[a/b.md]]", "a/b.md", "a/b.md", "a/b", "md", "")
+	test("[[a/b.md|L]]", "L", "a/b.md", "a/b", "md", "")
+	test("[[a/b.md#sec]]", "a/b.md#sec", "a/b.md#sec", "a/b", "md", "sec")
+	test("[[a/b.md#sec|L]]", "L", "a/b.md#sec", "a/b", "md", "sec")
+	test("[[a.b/c]]", "a.b/c", "a.b/c", "a.b/c", "", "")
+	test("[[Chapter 1.2]]", "Chapter 1.2", "Chapter 1.2", "Chapter 1.2", "", "")
+	test("[link](../a/b.md#sec)", "link", "../a/b.md#sec", "../a/b", "md", "sec")
+	// External links are not split.
+	test("[link](https://a.com/b.html#sec)", "link", "https://a.com/b.html#sec", "", "", "")
+}
 
-Paragraph
-`, map[string]interface{}{
-		"title": "A title",
-		"tags":  []interface{}{"tag1", "tag 2"},
-		"nested": map[string]interface{}{
-			"key": "value",
-		},
+func TestParseCitations(t *testing.T) {
+	test := func(source string, expected []string) {
+		content := parse(t, source)
+		assert.Equal(t, content.Citations, expected)
+	}
+
+	test("", []string{})
+	test("[@a]", []string{"a"})
+	test("As said by @b, this is true.", []string{"b"})
+	test("Contact x@y.com", []string{})
+	test("[see @smith2020, p. 33; -@doe:99]", []string{"smith2020", "doe:99"})
+	test("@a and @a again, [@b]", []string{"a", "b"})
+	// Citations in code are skipped.
+	test("`@code` and\n\n```\n@block\n```", []string{})
+	// URLs are not citations.
+	test("https://example.com/@user", []string{})
+
+	// Custom pattern matching the keys.
+	content := parseWithOptions(t, "@alice cited [@smith2020]", ParserOpts{
+		CitationKeyRegex: regexp.MustCompile(`\d{4}$`),
 	})
+	assert.Equal(t, content.Citations, []string{"smith2020"})
 }
 
-func parse(t *testing.T, source string) core.NoteContent {
-	return parseWithOptions(t, source, ParserOpts{
-		HashtagEnabled:      true,
-		MultiWordTagEnabled: true,
-		ColontagEnabled:     true,
+func TestParseMentions(t *testing.T) {
+	test := func(source string, expected []string) {
+		content := parseWithOptions(t, source, ParserOpts{
+			MentionEnabled: true,
+		})
+		assert.Equal(t, content.Mentions, expected)
+	}
+
+	test("", []string{})
+	test("Meeting with @alice.", []string{"alice"})
+	test("Contact bob@example.com", []string{})
+	test("@a-b_c and @a-b_c, (@dave)", []string{"a-b_c", "dave"})
+	test("@élodie", []string{"élodie"})
+	// Mentions in code and citations are skipped.
+	test("`@code` and [@smith2020]", []string{})
+	test("```\n@block\n```", []string{})
+
+	// Custom charset
+	content := parseWithOptions(t, "@john.doe", ParserOpts{
+		MentionEnabled: true,
+		MentionCharset: ".",
 	})
+	assert.Equal(t, content.Mentions, []string{"john.doe"})
+
+	// Disabled by default
+	content = parse(t, "@alice")
+	assert.Equal(t, content.Mentions, []string{})
 }
 
-func parseWithOptions(t *testing.T, source string, options ParserOpts) core.NoteContent {
-	content, err := NewParser(options, &util.NullLogger).ParseNoteContent(source)
-	assert.Nil(t, err)
-	return *content
+func TestParseWikiLinkLabelOrder(t *testing.T) {
+	test := func(source string, labelFirst bool, href string, title string) {
+		content := parseWithOptions(t, source, ParserOpts{
+			WikiLinkLabelFirst: labelFirst,
+		})
+		assert.Equal(t, len(content.Links), 1)
+		assert.Equal(t, content.Links[0].Href, href)
+		assert.Equal(t, content.Links[0].Title, title)
+	}
+
+	test("[[target|Label]]", false, "target", "Label")
+	test("[[Label|target]]", true, "target", "Label")
+	test("[[Label | target]]#", true, "target", "Label")
+	// Without a label, the target is used for both.
+	test("[[target]]", false, "target", "target")
+	test("[[target]]", true, "target", "target")
+}
+
+func TestParseLinkTargetLowercase(t *testing.T) {
+	test := func(source string, lowercase bool, href string, title string, normalized string) {
+		content := parseWithOptions(t, source, ParserOpts{LinkTargetLowercase: lowercase})
+		assert.Equal(t, len(content.Links), 1)
+		assert.Equal(t, content.Links[0].Href, href)
+		assert.Equal(t, content.Links[0].Title, title)
+		assert.Equal(t, content.Links[0].NormalizedTarget, normalized)
+	}
+
+	// Disabled by default.
+	test("[[My Note]]", false, "My Note", "My Note", "")
+
+	test("[[My Note]]", true, "My Note", "My Note", "my note")
+	test("[[ Été Note#Section | Label ]]", true, "Été Note#Section", "Label", "été note")
+	test("[Label](Folder/My-Note.md)", true, "Folder/My-Note.md", "Label", "folder/my-note")
+	// External links are not normalized.
+	test("[Label](https://Example.com)", true, "https://Example.com", "Label", "")
+}
+
+func TestParseAbsolutePathWarnings(t *testing.T) {
+	test := func(opts ParserOpts, source string, links int, warnings []string) {
+		content := parseWithOptions(t, source, opts)
+		assert.Equal(t, len(content.Links), links)
+		assert.Equal(t, content.Warnings, warnings)
+	}
+
+	source := `---
+up: /Users/me/notes/index.md
+---
+
+# Title
+
+[POSIX](/Users/me/notes/y.md), [again](/Users/me/notes/y.md), [Windows](C:\Users\me\z.md),
+[Windows](D:/notes/w.md), [relative](../y.md), [[wiki]] and <https://example.com/a>.`
+
+	// Disabled by default.
+	test(ParserOpts{}, source, 8, []string{})
+
+	test(ParserOpts{AbsolutePathWarningsEnabled: true}, source, 8, []string{
+		`the link "/Users/me/notes/index.md" uses an absolute path`,
+		`the link "/Users/me/notes/y.md" uses an absolute path`,
+		`the link "C:\\Users\\me\\z.md" uses an absolute path`,
+		`the link "D:/notes/w.md" uses an absolute path`,
+	})
+}
+
+func TestParseLinkTextWarnings(t *testing.T) {
+	test := func(opts ParserOpts, source string, links int, warnings []string) {
+		content := parseWithOptions(t, "# Title\n\n"+source, opts)
+		assert.Equal(t, len(content.Links), links)
+		assert.Equal(t, content.Warnings, warnings)
+	}
+
+	enabled := ParserOpts{LinkTextWarningsEnabled: true}
+
+	// Disabled by default.
+	test(ParserOpts{}, "[click here](a.md)", 1, []string{})
+
+	test(enabled, "A [good link](a.md), a [[wiki link]] and a [[b|labelled one]].", 3, []string{})
+	test(enabled, "[https://example.com](https://example.com) and <https://example.com/b>", 2, []string{
+		`the link "https://example.com" has a bare URL as text`,
+		`the link "https://example.com/b" has a bare URL as text`,
+	})
+	test(enabled, "[Click here!](a.md), [here](b.md), [[c|Read more]] and [Click here!](a.md) again.", 4, []string{
+		`the link "a.md" has a meaningless text "Click here!"`,
+		`the link "b.md" has a meaningless text "here"`,
+		`the link "c" has a meaningless text "Read more"`,
+	})
+	test(enabled, "An empty [](a.md) link.", 1, []string{
+		`the link "a.md" has no text`,
+	})
+	test(ParserOpts{LinkTextWarningsEnabled: true, VagueLinkTexts: []string{"ici"}}, "[ici](a.md) and [here](b.md)", 2, []string{
+		`the link "a.md" has a meaningless text "ici"`,
+	})
+}
+
+func TestParseLinkCountsByKind(t *testing.T) {
+	content := parseWithOptions(t, "# Title\n\nSee [[A]] and [B](b.md).\n\n![[C]]\n\nFrom <https://example.com>.", ParserOpts{})
+	assert.Equal(t, content.InternalLinkCount(), 3)
+	assert.Equal(t, content.ExternalLinkCount(), 1)
+}
+
+func TestParseMangledWikiLinks(t *testing.T) {
+	test := func(source string, href string, title string, rels ...string) {
+		content := parseWithOptions(t, source, ParserOpts{})
+		assert.Equal(t, len(content.Links), 1)
+		assert.Equal(t, content.Links[0].Href, href)
+		assert.Equal(t, content.Links[0].Title, title)
+		assert.Equal(t, content.Links[0].Rels, core.LinkRels(rels...))
+	}
+
+	// Curly quotes wrapping the target are stripped.
+	test("A [[“target”]] link", "target", "target")
+	test("A [[‘target’|Label]] link", "target", "Label")
+	test("A [[„Ziel“]] link", "Ziel", "Ziel")
+	test("A [[« target »]] link", "target", "target")
+	// Unbalanced or inner quotes are kept.
+	test("A [[“target]] link", "“target", "“target")
+	test("A [[Don’t panic]] link", "Don’t panic", "Don’t panic")
+
+	// Fullwidth brackets.
+	test("A ［［target］］ link", "target", "target")
+	test("A ［［［target］］］ link", "target", "target", "down")
+	test("A #［［“target”］］ link", "target", "target", "up")
+	test("A ［target］ and ［［target］］", "target", "target")
+	test("参见［［目标］］。", "目标", "目标")
+	test("参见!［［目标］］", "目标", "目标")
+	test("A ［［target|Label］］", "target", "Label")
+	// A link ending a heading line is not followed by a stray bracket.
+	test("## A ［［target］］", "target", "target")
+
+	// The fullwidth brackets are kept in the body, and the following offsets
+	// match the original source.
+	source := "A ［［x］］ and #tag"
+	content := parseWithOptions(t, source, ParserOpts{HashtagEnabled: true, LinkPositionsEnabled: true})
+	assert.Equal(t, content.Body, opt.NewString(source))
+	assert.Equal(t, content.Links[0].Line, 1)
+	assert.Equal(t, content.Links[0].Column, 3)
+	assert.Equal(t, content.Links[0].SnippetEnd, len(source))
+	offset := -1
+	parseWithOptions(t, source, ParserOpts{
+		HashtagEnabled: true,
+		OnTag: func(tag string, pos core.Position) {
+			offset = pos.Offset
+		},
+	})
+	assert.Equal(t, offset, strings.Index(source, "#tag"))
+	assert.Equal(t, offset, 20)
+}
+
+func TestParseLinksWithResolver(t *testing.T) {
+	resolvedTargets := []string{}
+	content := parseWithOptions(t, `
+[[Known]], [[Unknown]], [known](known.md) and [external](http://known.md).
+`, ParserOpts{
+		LinkResolver: func(target string) (string, bool) {
+			resolvedTargets = append(resolvedTargets, target)
+			switch target {
+			case "Known":
+				return "1", true
+			case "known.md":
+				return "2", true
+			default:
+				return "", false
+			}
+		},
+	})
+
+	test := func(link core.Link, href string, resolved bool, resolvedID string) {
+		assert.Equal(t, link.Href, href)
+		assert.Equal(t, link.Resolved, resolved)
+		assert.Equal(t, link.ResolvedID, resolvedID)
+	}
+
+	assert.Equal(t, len(content.Links), 4)
+	test(content.Links[0], "Known", true, "1")
+	test(content.Links[1], "Unknown", false, "")
+	test(content.Links[2], "known.md", true, "2")
+	test(content.Links[3], "http://known.md", false, "")
+	// External links are not resolved.
+	assert.Equal(t, resolvedTargets, []string{"Known", "Unknown", "known.md"})
+}
+
+func TestParseWithVisitors(t *testing.T) {
+	paragraphs := 0
+	headings := []string{}
+
+	parseWithOptions(t, "# Title\n\nParagraph 1\n\n> Paragraph 2\n\n## Heading\n\n* Item", ParserOpts{
+		Visitors: []func(n ast.Node, entering bool, source []byte){
+			func(n ast.Node, entering bool, source []byte) {
+				if n.Kind() == ast.KindParagraph && entering {
+					paragraphs++
+				}
+			},
+			func(n ast.Node, entering bool, source []byte) {
+				if heading, ok := n.(*ast.Heading); ok && entering {
+					headings = append(headings, string(heading.Text(source)))
+				}
+			},
+		},
+	})
+
+	assert.Equal(t, paragraphs, 2)
+	assert.Equal(t, headings, []string{"Title", "Heading"})
+}
+
+func TestParseCodeKeywords(t *testing.T) {
+	test := func(source string, enabled bool, expected []string) {
+		content := parseWithOptions(t, source, ParserOpts{
+			CodeKeywordsEnabled: enabled,
+		})
+		assert.Equal(t, content.CodeKeywords, expected)
+	}
+
+	test("", true, []string{})
+	test("Call `ParseNoteContent` then `Walk`, not `ParseNoteContent`.", true, []string{"ParseNoteContent", "Walk"})
+	test("Call `ParseNoteContent`.", false, []string{})
+	// Fenced code blocks are ignored.
+	test("Call `Walk`.\n\n```go\nfunc Walk() {}\n```\n\n    indented()\n", true, []string{"Walk"})
+}
+
+func TestParseNoIndex(t *testing.T) {
+	test := func(source string, expected bool) {
+		content := parse(t, source)
+		assert.Equal(t, content.NoIndex, expected)
+	}
+
+	test("", false)
+	test("# Title\n\nParagraph with a <!-- comment -->", false)
+	test("# Title\n\n<!-- zk:noindex -->\n\nParagraph", true)
+	test("# Title\n\nParagraph <!--zk:NoIndex-->", true)
+	test("# Title\n\n<!-- zk:other -->", false)
+	// Directives in code are ignored.
+	test("# Title\n\n`<!-- zk:noindex -->`\n\n```\n<!-- zk:noindex -->\n```", false)
+}
+
+func TestParseCaseSensitiveFrontmatter(t *testing.T) {
+	source := "---\nTitle: Displayed title\ntitle: internal-title\nAuthor: Alice\n---\n\nBody"
+
+	content := parseWithOptions(t, source, ParserOpts{CaseSensitiveKeys: true})
+	assert.Equal(t, content.Title, opt.NewString("internal-title"))
+	assert.Equal(t, content.Metadata, map[string]interface{}{
+		"Title":  "Displayed title",
+		"title":  "internal-title",
+		"Author": "Alice",
+	})
+	front := frontmatter{values: content.Metadata, caseSensitive: true}
+	assert.Equal(t, front.getString("Title"), opt.NewString("Displayed title"))
+	assert.Equal(t, front.getString("title"), opt.NewString("internal-title"))
+	assert.Equal(t, front.getString("author"), opt.NullString)
+
+	// The title is still found with a capitalized key.
+	content = parseWithOptions(t, "---\nTitle: A title\n---\n", ParserOpts{CaseSensitiveKeys: true})
+	assert.Equal(t, content.Title, opt.NewString("A title"))
+
+	content = parseWithOptions(t, "---\nTitle: A title\nAuthor: Alice\n---\n", ParserOpts{})
+	assert.Equal(t, content.Metadata, map[string]interface{}{
+		"title":  "A title",
+		"author": "Alice",
+	})
+	front = frontmatter{values: content.Metadata}
+	assert.Equal(t, front.getString("Author"), opt.NewString("Alice"))
+}
+
+func TestParseBooleanFrontmatter(t *testing.T) {
+	test := func(value string, expected opt.Bool) {
+		content := parse(t, "---\ndraft: "+value+"\n---\n\nBody")
+		front := frontmatter{values: content.Metadata}
+		assert.Equal(t, front.getBool("draft"), expected)
+	}
+
+	test("true", opt.True)
+	test("false", opt.False)
+	test("yes", opt.True)
+	test("Off", opt.False)
+	test(`"yes"`, opt.True)
+	test(`"Off"`, opt.False)
+	test(`"ON"`, opt.True)
+	test(`"no"`, opt.False)
+	test("maybe", opt.NullBool)
+	test("1", opt.NullBool)
+}
+
+func TestParseParent(t *testing.T) {
+	test := func(frontmatter string, expectedParent opt.String, expectedLinks []core.Link) {
+		content := parse(t, "---\n"+frontmatter+"\n---\n\nBody")
+		assert.Equal(t, content.Parent, expectedParent)
+		assert.Equal(t, content.Links, expectedLinks)
+	}
+
+	test("title: A title", opt.NullString, []core.Link{})
+	test("up: \"\"", opt.NullString, []core.Link{})
+	test(`up: "[[Index]]"`, opt.NewString("Index"), []core.Link{
+		{
+			Href:   "Index",
+			Type:   core.LinkTypeWikiLink,
+			Rels:   core.LinkRels("parent"),
+			Target: "Index",
+		},
+	})
+	test(`up: "[[index|The index]]"`, opt.NewString("index"), []core.Link{
+		{
+			Title:  "The index",
+			Href:   "index",
+			Type:   core.LinkTypeWikiLink,
+			Rels:   core.LinkRels("parent"),
+			Target: "index",
+		},
+	})
+	test("parent: index.md", opt.NewString("index.md"), []core.Link{
+		{
+			Href:   "index.md",
+			Type:   core.LinkTypeMarkdown,
+			Rels:   core.LinkRels("parent"),
+			Target: "index",
+			Ext:    "md",
+		},
+	})
+	test("up: https://example.com", opt.NewString("https://example.com"), []core.Link{
+		{
+			Href:       "https://example.com",
+			Type:       core.LinkTypeMarkdown,
+			Rels:       core.LinkRels("parent"),
+			IsExternal: true,
+		},
+	})
+
+	content := parseWithOptions(t, "---\nfolgezettel: \"[[Index]]\"\nup: other\n---\n", ParserOpts{
+		ParentKeys: []string{"folgezettel"},
+	})
+	assert.Equal(t, content.Parent, opt.NewString("Index"))
+}
+
+func TestParseCanonical(t *testing.T) {
+	test := func(frontmatter string, expectedCanonical opt.String, expectedLinks []core.Link) {
+		content := parse(t, "---\n"+frontmatter+"\n---\n\nBody")
+		assert.Equal(t, content.Canonical, expectedCanonical)
+		assert.Equal(t, content.Links, expectedLinks)
+	}
+
+	test("title: A title", opt.NullString, []core.Link{})
+	test(`canonical: "[[Real Note]]"`, opt.NewString("Real Note"), []core.Link{
+		{
+			Href:   "Real Note",
+			Type:   core.LinkTypeWikiLink,
+			Rels:   core.LinkRels("canonical"),
+			Target: "Real Note",
+		},
+	})
+	test("redirect: real.md", opt.NewString("real.md"), []core.Link{
+		{
+			Href:   "real.md",
+			Type:   core.LinkTypeMarkdown,
+			Rels:   core.LinkRels("canonical"),
+			Target: "real",
+			Ext:    "md",
+		},
+	})
+}
+
+func TestParseSlug(t *testing.T) {
+	test := func(frontmatter string, expected opt.String) {
+		content := parse(t, "---\n"+frontmatter+"\n---\n\n# A title")
+		assert.Equal(t, content.Slug, expected)
+	}
+
+	test("title: A title", opt.NullString)
+	test("slug: my-post", opt.NewString("my-post"))
+	test("permalink: /blog/X/", opt.NewString("/blog/X/"))
+	test("slug: My_Post\npermalink: /blog/x/", opt.NewString("My_Post"))
+
+	content := parseWithOptions(t, "---\nurl: /x\nslug: y\n---\n", ParserOpts{
+		SlugKeys: []string{"url"},
+	})
+	assert.Equal(t, content.Slug, opt.NewString("/x"))
+}
+
+func TestParseSeries(t *testing.T) {
+	test := func(frontmatter string, expectedSeries opt.String, expectedList []string, expectedOrder opt.Int) {
+		content := parse(t, "---\n"+frontmatter+"\n---\n\n# A title")
+		assert.Equal(t, content.Series, expectedSeries)
+		assert.Equal(t, content.SeriesList, expectedList)
+		assert.Equal(t, content.SeriesOrder, expectedOrder)
+	}
+
+	test("title: A title", opt.NullString, []string{}, opt.NullInt)
+	test("series: Go Basics", opt.NewString("Go Basics"), []string{"Go Basics"}, opt.NullInt)
+	test("series: [Go Basics, Concurrency]", opt.NewString("Go Basics"), []string{"Go Basics", "Concurrency"}, opt.NullInt)
+	test("series: Go Basics\nseries_order: 3", opt.NewString("Go Basics"), []string{"Go Basics"}, opt.NewInt(3))
+
+	content := parseWithOptions(t, "---\ncollection: Go Basics\npart: 2\n---\n", ParserOpts{
+		SeriesKeys:      []string{"collection"},
+		SeriesOrderKeys: []string{"part"},
+	})
+	assert.Equal(t, content.Series, opt.NewString("Go Basics"))
+	assert.Equal(t, content.SeriesOrder, opt.NewInt(2))
+}
+
+func TestParseWeight(t *testing.T) {
+	test := func(frontmatter string, expected opt.Int) {
+		content := parse(t, "---\n"+frontmatter+"\n---\n\nBody")
+		assert.Equal(t, content.Weight, expected)
+	}
+
+	test("title: A title", opt.NullInt)
+	test("weight: 5", opt.NewInt(5))
+	test("order: -2", opt.NewInt(-2))
+	test("weight: 5\norder: -2", opt.NewInt(5))
+	test("weight: five", opt.NullInt)
+	test("weight: \"5\"", opt.NullInt)
+	test("weight: 1.5", opt.NullInt)
+
+	content := parseWithOptions(t, "---\nrank: 3\nweight: 5\n---\n\nBody", ParserOpts{
+		WeightKeys: []string{"rank"},
+	})
+	assert.Equal(t, content.Weight, opt.NewInt(3))
+}
+
+func TestParseTables(t *testing.T) {
+	test := func(source string, enabled bool, expected []core.Table) {
+		content := parseWithOptions(t, source, ParserOpts{
+			TablesEnabled: enabled,
+		})
+		assert.Equal(t, content.Tables, expected)
+	}
+
+	source := `# Title
+
+| Name  | Language | Link           |
+|-------|----------|----------------|
+| *zk*  | ` + "`Go`" + `     | [site](https://example.com) |
+| Other | **Rust** | none           |
+`
+
+	test("# Title", true, []core.Table{})
+	test(source, false, []core.Table{})
+	test(source, true, []core.Table{
+		{
+			Header: []string{"Name", "Language", "Link"},
+			Rows: [][]string{
+				{"zk", "Go", "site"},
+				{"Other", "Rust", "none"},
+			},
+		},
+	})
+}
+
+func TestParseFootnotes(t *testing.T) {
+	test := func(source string, enabled bool, expected []core.Footnote) {
+		content := parseWithOptions(t, source, ParserOpts{
+			FootnotesEnabled: enabled,
+		})
+		assert.Equal(t, content.Footnotes, expected)
+	}
+
+	source := `# Title
+
+A reference footnote[^ref] and an inline one^[With *emphasis* and [brackets]].
+
+[^ref]: The *reference* note.
+`
+
+	test("# Title", true, []core.Footnote{})
+	test(source, false, []core.Footnote{})
+	test(source, true, []core.Footnote{
+		{Text: "With emphasis and [brackets]", Inline: true},
+		{Label: "ref", Text: "The reference note."},
+	})
+	// Unclosed and code footnotes are ignored.
+	test("An unclosed ^[footnote.\n\n`^[code]`", true, []core.Footnote{})
+}
+
+func TestParseCallouts(t *testing.T) {
+	test := func(source string, expected []core.Callout) {
+		content := parse(t, source)
+		assert.Equal(t, content.Callouts, expected)
+	}
+
+	test("", []core.Callout{})
+	test("> A plain quote\n> on two lines", []core.Callout{})
+	test("> Not a [!note] callout", []core.Callout{})
+	test("> [!warning] *Careful*\n> The body\n> of the callout.\n>\n> Second paragraph", []core.Callout{
+		{Type: "warning", Title: "Careful", Body: "The body\nof the callout.\n\nSecond paragraph"},
+	})
+	test("> [!NOTE]\n> Without title", []core.Callout{
+		{Type: "note", Body: "Without title"},
+	})
+	test("> [!faq]- Folded\n\n> [!tip]", []core.Callout{
+		{Type: "faq", Title: "Folded"},
+		{Type: "tip"},
+	})
+}
+
+func TestParseWordCountWithQuotes(t *testing.T) {
+	quote := strings.Repeat("A rather long sentence quoted from a book.\n", 50)
+	source := "# Title\n\nSome original words.\n\n> " + strings.ReplaceAll(strings.TrimSpace(quote), "\n", "\n> ") +
+		"\n>\n> > A nested quote.\n\nAnd the end, with `code`.\n\n```\nA code block\n```"
+
+	test := func(options ParserOpts, words int) {
+		content := parseWithOptions(t, source, options)
+		assert.Equal(t, content.Stats.Words, words)
+		assert.Equal(t, content.Headings[0].WordCount, words)
+	}
+
+	// Quotes are counted by default, unlike code blocks.
+	test(ParserOpts{}, 3+50*8+3+5)
+	test(ParserOpts{SkipQuotesInWordCount: true}, 3+5)
+}
+
+func TestParseStats(t *testing.T) {
+	test := func(source string, expected core.NoteStats) {
+		content := parse(t, source)
+		assert.Equal(t, content.Stats, expected)
+	}
+
+	test("", core.NoteStats{})
+	test(`# Heading
+
+A [link](target) and an ![image](image.png).
+
+* Item
+
+`+"```"+`
+# Not a heading
+* not an item
+[not a link](target)
+`+"```"+`
+`, core.NoteStats{
+		Headings:   1,
+		Links:      1,
+		Images:     1,
+		CodeBlocks: 1,
+		ListItems:  1,
+		Words:      6,
+	})
+}
+
+func TestParseMetadataFromFrontmatter(t *testing.T) {
+	test := func(source string, expectedMetadata map[string]interface{}) {
+		content := parse(t, source)
+		assert.Equal(t, content.Metadata, expectedMetadata)
+	}
+
+	test("", map[string]interface{}{})
+	test("# A title", map[string]interface{}{})
+	test("---\n---\n# A title", map[string]interface{}{})
+	test(`---
+title: A title
+tags:
+  - tag1
+  - "tag 2"
+nested:
+  key: value
+---
+
+Paragraph
+`, map[string]interface{}{
+		"title": "A title",
+		"tags":  []interface{}{"tag1", "tag 2"},
+		"nested": map[string]interface{}{
+			"key": "value",
+		},
+	})
+}
+
+func TestParseFrontmatterFormat(t *testing.T) {
+	test := func(source string, expectedFormat core.FrontmatterFormat) {
+		content := parse(t, source)
+		assert.Equal(t, content.FrontmatterFormat, expectedFormat)
+	}
+
+	test("", core.FrontmatterFormatNone)
+	test("# A title\n\n---\n\nParagraph", core.FrontmatterFormatNone)
+	test("# A title\n\n---\n\nParagraph\n\n---\n", core.FrontmatterFormatNone)
+	test("---\ntitle: A title\n---\n\nParagraph", core.FrontmatterFormatYAML)
+	test("---\ntitle: Unterminated\n", core.FrontmatterFormatYAML)
+	test("---yaml\ntitle: A title\n---\n\nParagraph", core.FrontmatterFormatYAML)
+	test("--- json\n{\"title\": \"A title\"}\n---\n\nParagraph", core.FrontmatterFormatJSON)
+	test("---JSON\n{\"title\": \"A title\"}\n---\n\nParagraph", core.FrontmatterFormatJSON)
+	// A JSON object is detected without info string.
+	test("---\n{\"title\": \"A title\"}\n---\n\nParagraph", core.FrontmatterFormatJSON)
+	test("---\n\n  {\n  \"title\": \"A title\"\n  }\n---\n\nParagraph", core.FrontmatterFormatJSON)
+	test("+++\ntitle = \"A title\"\n+++\n\nParagraph", core.FrontmatterFormatTOML)
+	test("+++ \r\ntitle = \"A title\"\r\n+++\r\n\r\nParagraph", core.FrontmatterFormatTOML)
+	// A TOML frontmatter must be closed.
+	test("+++\ntitle = \"A title\"\n\nParagraph", core.FrontmatterFormatNone)
+}
+
+func TestParseTOMLFrontmatter(t *testing.T) {
+	content := parseWithOptions(t, `+++
+title = "A title"
+tags = ["tag1", "#tag2"]
+difficulty = 3
+
+[meta]
+key = "value"
++++
+
+Lead paragraph with #tag3
+
+Body
+`, ParserOpts{HashtagEnabled: true})
+
+	assert.Equal(t, content.FrontmatterFormat, core.FrontmatterFormatTOML)
+	assert.Equal(t, content.Title, opt.NewString("A title"))
+	assert.Equal(t, content.Difficulty, opt.NewInt(3))
+	assert.Equal(t, content.Tags, []string{"tag1", "tag2", "tag3"})
+	assert.Equal(t, content.Lead, opt.NewString("Lead paragraph with #tag3"))
+	assert.Equal(t, content.Body, opt.NewString("Lead paragraph with #tag3\n\nBody"))
+	assert.Equal(t, content.Metadata["meta"], map[string]interface{}{"key": "value"})
+}
+
+func TestParseInvalidTOMLFrontmatter(t *testing.T) {
+	source := "+++\ntitle = \n+++\n\n# Title\n\nBody"
+
+	parser := NewParser(ParserOpts{}, &util.NullLogger)
+	_, err := parser.ParseNoteContent(source)
+	assert.NotNil(t, err)
+
+	content := parseWithOptions(t, source, ParserOpts{LenientFrontmatter: true})
+	assert.Equal(t, content.FrontmatterFormat, core.FrontmatterFormatTOML)
+	assert.Equal(t, content.Title, opt.NewString("Title"))
+	assert.Equal(t, content.Body, opt.NewString("Body"))
+	assert.Equal(t, content.Warnings, []string{`the frontmatter line "title =" can't be decoded`})
+}
+
+func TestParseFrontmatterWithInfoString(t *testing.T) {
+	test := func(source string) {
+		content := parse(t, source)
+		assert.Equal(t, content.Title, opt.NewString("A title"))
+		assert.Equal(t, content.Body, opt.NewString("Paragraph"))
+		assert.Equal(t, content.Metadata, map[string]interface{}{
+			"title": "A title",
+			"tags":  []interface{}{"a", "b"},
+		})
+		assert.Equal(t, content.Tags, []string{"a", "b"})
+	}
+
+	test("---yaml\ntitle: A title\ntags: [a, b]\n---\n\nParagraph")
+	test("--- yaml\ntitle: A title\ntags: [a, b]\n---\n\nParagraph")
+	test("---YAML  \r\ntitle: A title\r\ntags: [a, b]\r\n---\r\n\r\nParagraph")
+}
+
+func TestParseFrontmatterWithEndOfDocumentMarker(t *testing.T) {
+	test := func(source string) {
+		content := parse(t, source)
+		assert.Equal(t, content.Title, opt.NewString("A title"))
+		assert.Equal(t, content.Body, opt.NewString("Paragraph\n\n..."))
+		assert.Equal(t, content.Metadata, map[string]interface{}{
+			"title": "A title",
+		})
+	}
+
+	test("---\ntitle: A title\n...\nParagraph\n\n...")
+	test("---yaml\ntitle: A title\n...\n\nParagraph\n\n...")
+	test("---\ntitle: A title\n...  \n\nParagraph\n\n...")
+}
+
+func TestParseConsumedKeys(t *testing.T) {
+	test := func(source string, expected []string) {
+		content := parse(t, source)
+		assert.Equal(t, content.ConsumedKeys, expected)
+	}
+
+	test("# Title", []string{})
+	test("---\ntitle: A title\n---\n# Heading", []string{"title"})
+	test("---\nauthor: Alice\n---\n# Heading", []string{})
+	// The title is not consumed when empty.
+	test("---\ntitle: \"\"\n---\n# Heading", []string{})
+	// The type is only consumed when it makes the note a MOC.
+	test("---\ntype: article\n---\n# Heading", []string{})
+	test("---\ntype: MOC\n---\n# Heading", []string{"type"})
+	test(`---
+Title: A title
+Tags: [a, b]
+keywords: c
+private: true
+modified: 2021-05-01
+unknown: value
+---
+Body
+`, []string{"keywords", "modified", "private", "tags", "title"})
+}
+
+func TestParseVisibility(t *testing.T) {
+	test := func(frontmatter string, expected core.Visibility) {
+		content := parse(t, "---\n"+frontmatter+"\n---\n\nBody")
+		assert.Equal(t, content.Visibility, expected)
+	}
+
+	test("", core.VisibilityUnspecified)
+	test("publish: maybe", core.VisibilityUnspecified)
+	test("publish: true", core.VisibilityPublic)
+	test("publish: false", core.VisibilityPrivate)
+	test("private: true", core.VisibilityPrivate)
+	test("private: false", core.VisibilityPublic)
+	test("Private: true", core.VisibilityPrivate)
+	// Conflicting flags
+	test("private: true\npublish: true", core.VisibilityPrivate)
+	test("private: false\npublish: false", core.VisibilityPrivate)
+	test("private: false\npublish: true", core.VisibilityPublic)
+}
+
+func TestParseIsMOC(t *testing.T) {
+	test := func(frontmatter string, options ParserOpts, expected bool) {
+		content := parseWithOptions(t, "---\n"+frontmatter+"\n---\n\nBody", options)
+		assert.Equal(t, content.IsMOC, expected)
+	}
+
+	test("", ParserOpts{}, false)
+	test("moc: true", ParserOpts{}, true)
+	test("MOC: false", ParserOpts{}, false)
+	test("type: moc", ParserOpts{}, true)
+	test("type: MOC", ParserOpts{}, true)
+	test("type: note", ParserOpts{}, false)
+	test("moc: false\ntype: moc", ParserOpts{}, false)
+	// Custom keys
+	test("structure: true", ParserOpts{MOCKeys: []string{"index", "structure"}}, true)
+	test("moc: true", ParserOpts{MOCKeys: []string{"structure"}}, false)
+	// An empty list disables the boolean keys.
+	test("moc: true", ParserOpts{MOCKeys: []string{}}, false)
+	test("type: moc", ParserOpts{MOCKeys: []string{}}, true)
+}
+
+func TestParseIsPinned(t *testing.T) {
+	test := func(frontmatter string, options ParserOpts, expected bool) {
+		content := parseWithOptions(t, "---\n"+frontmatter+"\n---\n\n# Title", options)
+		assert.Equal(t, content.IsPinned, expected)
+	}
+
+	test("title: Title", ParserOpts{}, false)
+	test("pinned: true", ParserOpts{}, true)
+	test("Favorite: yes", ParserOpts{}, true)
+	test("pinned: false", ParserOpts{}, false)
+	test("pinned: false\nfavorite: true", ParserOpts{}, false)
+	// Custom keys
+	test("starred: true", ParserOpts{PinnedKeys: []string{"starred"}}, true)
+	test("pinned: true", ParserOpts{PinnedKeys: []string{"starred"}}, false)
+}
+
+func TestParseStatus(t *testing.T) {
+	test := func(frontmatter string, values []string, expected opt.String, warnings []string) {
+		content := parseWithOptions(t, "---\n"+frontmatter+"\n---\n\n# Title", ParserOpts{StatusValues: values})
+		assert.Equal(t, content.Status, expected)
+		assert.Equal(t, content.Warnings, warnings)
+	}
+
+	values := []string{"idea", "draft", "review", "done"}
+
+	test("title: Title", values, opt.NullString, []string{})
+	test("status: draft", values, opt.NewString("draft"), []string{})
+	test("Status: \" Done \"", values, opt.NewString("Done"), []string{})
+	// An unknown status is kept.
+	test("status: wip", values, opt.NewString("wip"), []string{
+		`the status "wip" is not one of: idea, draft, review, done`,
+	})
+	// Any status is allowed by default.
+	test("status: wip", nil, opt.NewString("wip"), []string{})
+}
+
+func TestParseLuhmannID(t *testing.T) {
+	idRegex := regexp.MustCompile(`^[0-9]+(?:[a-z]+[0-9]*)*\b`)
+
+	test := func(opts ParserOpts, path string, source string, id opt.String, title opt.String) {
+		content, err := NewParser(opts, &util.NullLogger).ParseNoteContentAt(path, source)
+		assert.Nil(t, err)
+		assert.Equal(t, content.LuhmannID, id)
+		assert.Equal(t, content.Title, title)
+	}
+
+	// Disabled by default.
+	test(ParserOpts{}, "1a2b-note.md", "# 1a2b Title", opt.NullString, opt.NewString("1a2b Title"))
+
+	opts := ParserOpts{LuhmannIDRegex: idRegex}
+	test(opts, "dir/1a2b-note.md", "# Title", opt.NewString("1a2b"), opt.NewString("Title"))
+	test(opts, "note.md", "# 1a2b Title", opt.NewString("1a2b"), opt.NewString("1a2b Title"))
+	test(opts, "note.md", "# Title", opt.NullString, opt.NewString("Title"))
+	test(opts, "note.md", "# 12abc Title", opt.NewString("12abc"), opt.NewString("12abc Title"))
+	test(opts, "note.md", "# A1a2b Title", opt.NullString, opt.NewString("A1a2b Title"))
+	// The title has precedence over the file name.
+	test(opts, "3c-note.md", "# 1a2b Title", opt.NewString("1a2b"), opt.NewString("1a2b Title"))
+
+	opts.StripLuhmannIDFromTitle = true
+	test(opts, "note.md", "# 1a2b - Title", opt.NewString("1a2b"), opt.NewString("Title"))
+	test(opts, "note.md", "# 1a2b", opt.NewString("1a2b"), opt.NullString)
+	test(opts, "1a2b-note.md", "# Title", opt.NewString("1a2b"), opt.NewString("Title"))
+
+	// A capture group extracts the ID from a larger match.
+	opts = ParserOpts{LuhmannIDRegex: regexp.MustCompile(`^\[([0-9a-z/]+)\]`), StripLuhmannIDFromTitle: true}
+	test(opts, "note.md", "# [1/2a] Title", opt.NewString("1/2a"), opt.NewString("Title"))
+}
+
+func TestParseCommentOnlyBody(t *testing.T) {
+	test := func(opts ParserOpts, source string, body opt.String, lead opt.String, noIndex bool) {
+		content := parseWithOptions(t, source, opts)
+		assert.Equal(t, content.Body, body)
+		assert.Equal(t, content.Lead, lead)
+		assert.Equal(t, content.NoIndex, noIndex)
+	}
+
+	opts := ParserOpts{SkipCommentOnlyBody: true}
+
+	test(opts, "---\ntitle: Title\n---\n\n<!-- zk:noindex -->\n", opt.NullString, opt.NullString, true)
+	test(opts, "# Title\n\n<!-- A comment -->\n\n<!--\nspanning lines\n-->", opt.NullString, opt.NullString, false)
+	// A lead declared in the frontmatter is kept.
+	test(opts, "---\nabstract: A lead\n---\n\n# Title\n\n<!-- A comment -->", opt.NullString, opt.NewString("A lead"), false)
+	// Other content is kept.
+	test(opts, "# Title\n\n<!-- zk:noindex -->\n\nA paragraph", opt.NewString("<!-- zk:noindex -->\n\nA paragraph"), opt.NewString("<!-- zk:noindex -->"), true)
+	test(opts, "# Title\n\n<!-- A comment --> and text", opt.NewString("<!-- A comment --> and text"), opt.NewString("<!-- A comment --> and text"), false)
+	// Disabled by default.
+	test(ParserOpts{}, "# Title\n\n<!-- zk:noindex -->", opt.NewString("<!-- zk:noindex -->"), opt.NewString("<!-- zk:noindex -->"), true)
+}
+
+func TestParseSortTitle(t *testing.T) {
+	test := func(source string, opts ParserOpts, expected opt.String) {
+		content := parseWithOptions(t, source, opts)
+		assert.Equal(t, content.SortTitle, expected)
+	}
+
+	test("---\ntitle_sort: \"Great Gatsby, The\"\n---\n\n# The Great Gatsby", ParserOpts{}, opt.NewString("Great Gatsby, The"))
+	test("---\nsort_title: \" Great Gatsby, The \"\n---\n\n# The Great Gatsby", ParserOpts{}, opt.NewString("Great Gatsby, The"))
+	test("---\nsort: Gatsby\n---\n\n# The Great Gatsby", ParserOpts{SortTitleKeys: []string{"sort"}}, opt.NewString("Gatsby"))
+	// Falls back on the title.
+	test("# The Great Gatsby", ParserOpts{}, opt.NewString("The Great Gatsby"))
+	test("---\ntitle: The Great Gatsby\n---\n\nBody", ParserOpts{}, opt.NewString("The Great Gatsby"))
+	test("Body", ParserOpts{}, opt.NullString)
+}
+
+func TestParseTitleHeadingLevel(t *testing.T) {
+	test := func(source string, title opt.String, body opt.String) {
+		content := parseWithOptions(t, source, ParserOpts{})
+		assert.Equal(t, content.Title, title)
+		assert.Equal(t, content.Body, body)
+	}
+
+	test("---\ntitle_heading: 2\n---\n\n# Heading 1\n\n## Heading 2\n\nBody",
+		opt.NewString("Heading 2"), opt.NewString("Body"))
+	test("---\ntitle_heading: 2\n---\n\n## \n\n## Heading 2\n\n## Another",
+		opt.NewString("Heading 2"), opt.NewString("## Another"))
+	// Without any heading of this level, the default title is used.
+	test("---\ntitle_heading: 3\n---\n\n## Heading 2\n\n# Heading 1\n\nBody",
+		opt.NewString("Heading 1"), opt.NewString("Body"))
+	// Invalid levels are ignored.
+	test("---\ntitle_heading: 7\n---\n\n# Heading 1\n\n## Heading 2",
+		opt.NewString("Heading 1"), opt.NewString("## Heading 2"))
+	test("---\ntitle_heading: two\n---\n\n# Heading 1\n\n## Heading 2",
+		opt.NewString("Heading 1"), opt.NewString("## Heading 2"))
+	// The frontmatter title has precedence.
+	test("---\ntitle: Title\ntitle_heading: 2\n---\n\n# Heading 1\n\n## Heading 2",
+		opt.NewString("Title"), opt.NewString("# Heading 1\n\n## Heading 2"))
+}
+
+func TestParsePriorityAndDifficulty(t *testing.T) {
+	test := func(frontmatter string, priority opt.String, difficulty opt.Int, warnings []string) {
+		content := parseWithOptions(t, "---\n"+frontmatter+"\n---\n\n# Title", ParserOpts{})
+		assert.Equal(t, content.Priority, priority)
+		assert.Equal(t, content.Difficulty, difficulty)
+		assert.Equal(t, content.Warnings, warnings)
+	}
+
+	test("title: Title", opt.NullString, opt.NullInt, []string{})
+	test("priority: high\ndifficulty: 3", opt.NewString("high"), opt.NewInt(3), []string{})
+	test("priority: ' low '\ndifficulty: 0", opt.NewString("low"), opt.NewInt(0), []string{})
+	// An empty value is ignored.
+	test("priority: \ndifficulty: ", opt.NullString, opt.NullInt, []string{})
+
+	test("priority: [high, low]\ndifficulty: hard", opt.NullString, opt.NullInt, []string{
+		`the priority "[high low]" is not a string`,
+		`the difficulty "hard" is not an integer`,
+	})
+	test("difficulty: 2.5", opt.NullString, opt.NullInt, []string{
+		`the difficulty "2.5" is not an integer`,
+	})
+	test("priority: 1", opt.NullString, opt.NullInt, []string{
+		`the priority "1" is not a string`,
+	})
+}
+
+func TestParseTemplate(t *testing.T) {
+	test := func(frontmatter string, opts ParserOpts, expected opt.String) {
+		content := parseWithOptions(t, "---\n"+frontmatter+"\n---\n\n# Title", opts)
+		assert.Equal(t, content.Template, expected)
+	}
+
+	test("title: Title", ParserOpts{}, opt.NullString)
+	test("template: daily", ParserOpts{}, opt.NewString("daily"))
+	test("Template: daily", ParserOpts{}, opt.NewString("daily"))
+	// Custom keys.
+	test("template: daily", ParserOpts{TemplateKeys: []string{"created-from"}}, opt.NullString)
+	test("created-from: daily", ParserOpts{TemplateKeys: []string{"created-from"}}, opt.NewString("daily"))
+}
+
+func TestParseFrontmatterDotKeys(t *testing.T) {
+	test := func(frontmatter string, options ParserOpts, expected opt.String) {
+		content := parseWithOptions(t, "---\n"+frontmatter+"\n---\n\n# Title", options)
+		assert.Equal(t, content.Priority, expected)
+	}
+
+	flowMap := "meta: {a: high, b: low, C: upper}"
+	test(flowMap, ParserOpts{PriorityKeys: []string{"meta.a"}}, opt.NewString("high"))
+	test(flowMap, ParserOpts{PriorityKeys: []string{"meta.b"}}, opt.NewString("low"))
+	test(flowMap, ParserOpts{PriorityKeys: []string{"meta.c"}}, opt.NewString("upper"))
+	test(flowMap, ParserOpts{PriorityKeys: []string{"meta.c"}, CaseSensitiveKeys: true}, opt.NullString)
+	test(flowMap, ParserOpts{PriorityKeys: []string{"meta.d", "meta.a.b", "meta"}}, opt.NullString)
+	test("meta:\n  nested:\n    a: deep", ParserOpts{PriorityKeys: []string{"meta.nested.a"}}, opt.NewString("deep"))
+	// A top-level key with dots is preferred.
+	test("meta.a: top\n"+flowMap, ParserOpts{PriorityKeys: []string{"meta.a"}}, opt.NewString("top"))
+}
+
+func TestFrontmatterFlowMap(t *testing.T) {
+	parser := NewParser(ParserOpts{}, &util.NullLogger)
+	source := []byte("---\nmeta: {a: 1, b: 2}\nother: {c: 1.5, d: true, e: two}\n---\n\n# Title")
+	context := goldparser.NewContext()
+	parser.md.Parser().Parse(text.NewReader(source), goldparser.WithContext(context))
+	frontmatter, err := parseFrontmatter(context, source, frontmatterFence{}, false, false)
+	assert.Nil(t, err)
+
+	assert.Equal(t, frontmatter.getString("meta.a"), opt.NewString("1"))
+	assert.Equal(t, frontmatter.getString("meta.b"), opt.NewString("2"))
+	assert.Equal(t, frontmatter.getString("Meta.B"), opt.NewString("2"))
+	assert.Equal(t, frontmatter.getInt("meta.a"), opt.NewInt(1))
+	assert.Equal(t, frontmatter.consumedKeys(), []string{"meta.a", "meta.b"})
+
+	// The other scalars are converted to strings as well.
+	assert.Equal(t, frontmatter.getString("other.c"), opt.NewString("1.5"))
+	assert.Equal(t, frontmatter.getString("other.d"), opt.NewString("true"))
+	assert.Equal(t, frontmatter.getString("other.e"), opt.NewString("two"))
+	assert.Equal(t, frontmatter.getString("other"), opt.NullString)
+}
+
+func TestFrontmatterBlankStringFallsBackOnNextKey(t *testing.T) {
+	parser := NewParser(ParserOpts{}, &util.NullLogger)
+	source := []byte("---\nsummary: \"  \"\ndescription: From description\n---\n\n# Title")
+	context := goldparser.NewContext()
+	parser.md.Parser().Parse(text.NewReader(source), goldparser.WithContext(context))
+	frontmatter, err := parseFrontmatter(context, source, frontmatterFence{}, false, false)
+	assert.Nil(t, err)
+
+	assert.Equal(t, frontmatter.getString("summary", "description"), opt.NewString("From description"))
+	assert.Equal(t, frontmatter.getString("summary"), opt.NullString)
+	assert.Equal(t, frontmatter.consumedKeys(), []string{"description"})
+}
+
+func TestFrontmatterTopLevelScalarsAreNotStrings(t *testing.T) {
+	parser := NewParser(ParserOpts{}, &util.NullLogger)
+	source := []byte("---\ntitle: 42\nstatus: true\n---\n\n# Title")
+	context := goldparser.NewContext()
+	parser.md.Parser().Parse(text.NewReader(source), goldparser.WithContext(context))
+	frontmatter, err := parseFrontmatter(context, source, frontmatterFence{}, false, false)
+	assert.Nil(t, err)
+
+	// Only the values nested under a dotted key are converted.
+	assert.Equal(t, frontmatter.getString("title"), opt.NullString)
+	assert.Equal(t, frontmatter.getString("status"), opt.NullString)
+	assert.Equal(t, frontmatter.consumedKeys(), []string{})
+}
+
+func TestParseAttachments(t *testing.T) {
+	test := func(frontmatter string, expected []string) {
+		content := parseWithOptions(t, "---\n"+frontmatter+"\n---\n\n# Title", ParserOpts{})
+		assert.Equal(t, content.Attachments, expected)
+	}
+
+	test("title: Title", []string{})
+	test("attachments: [a.pdf, ' b.png ']", []string{"a.pdf", "b.png"})
+	test("attachments:\n  - files/a report.pdf\n  - b.png", []string{"files/a report.pdf", "b.png"})
+	test(`attachments: " files/a report.pdf "`, []string{"files/a report.pdf"})
+}
+
+func TestParseDeclaredBacklinks(t *testing.T) {
+	test := func(frontmatter string, options ParserOpts, expected []string) {
+		content := parseWithOptions(t, "---\n"+frontmatter+"\n---\n\n# Title\n\nA [[link]].", options)
+		assert.Equal(t, content.DeclaredBacklinks, expected)
+		// Declared backlinks are not outgoing links.
+		assert.Equal(t, len(content.Links), 1)
+	}
+
+	test("title: Title", ParserOpts{}, []string{})
+	test(`backlinks: ["[[Index]]", "[[ notes/daily | Daily ]]", "projects/zk.md"]`, ParserOpts{}, []string{"Index", "notes/daily", "projects/zk.md"})
+	// Unquoted wiki links are parsed by YAML as nested lists.
+	test("backlinks:\n  - [[Index]]\n  - [[Index]]\n  - other.md", ParserOpts{}, []string{"Index", "other.md"})
+	test(`backlinks: "[[Index]]"`, ParserOpts{}, []string{"Index"})
+	test(`backlinks: ["[[Label|target]]"]`, ParserOpts{WikiLinkLabelFirst: true}, []string{"target"})
+	test(`linked_from: ["[[Index]]"]`, ParserOpts{BacklinkKeys: []string{"linked_from"}}, []string{"Index"})
+}
+
+func TestParseCSSClasses(t *testing.T) {
+	test := func(frontmatter string, expected []string) {
+		content := parseWithOptions(t, "---\n"+frontmatter+"\n---\n\n# Title", ParserOpts{})
+		assert.Equal(t, content.CSSClasses, expected)
+	}
+
+	test("title: Title", []string{})
+	test("cssclass: wide", []string{"wide"})
+	test(`cssclass: " wide  dark "`, []string{"wide", "dark"})
+	test("cssclasses: [wide, ' dark ']", []string{"wide", "dark"})
+	test("cssclasses:\n  - wide\n  - dark", []string{"wide", "dark"})
+}
+
+func TestParseIcon(t *testing.T) {
+	test := func(frontmatter string, options ParserOpts, expected opt.String) {
+		content := parseWithOptions(t, "---\n"+frontmatter+"\n---\n\n# Title", options)
+		assert.Equal(t, content.Icon, expected)
+	}
+
+	test("title: Title", ParserOpts{}, opt.NullString)
+	test("icon: 📕", ParserOpts{}, opt.NewString("📕"))
+	// Emojis made of several code points are kept whole.
+	test(`icon: "👩‍💻"`, ParserOpts{}, opt.NewString("👩‍💻"))
+	test("icon: lucide-book", ParserOpts{}, opt.NewString("lucide-book"))
+	test("emoji: 📕", ParserOpts{IconKeys: []string{"emoji"}}, opt.NewString("📕"))
+}
+
+func TestParseGeo(t *testing.T) {
+	test := func(frontmatter string, expected *core.Geo, warnings []string) {
+		content := parseWithOptions(t, "---\n"+frontmatter+"\n---\n\n# Title", ParserOpts{})
+		assert.Equal(t, content.Geo, expected)
+		assert.Equal(t, content.Warnings, warnings)
+	}
+
+	test("title: Title", nil, []string{})
+	test(`location: "48.85,2.35"`, &core.Geo{Lat: 48.85, Lng: 2.35}, []string{})
+	test(`location: "-33.9, 151.2 "`, &core.Geo{Lat: -33.9, Lng: 151.2}, []string{})
+	test("geo: {lat: 48.85, lng: 2}", &core.Geo{Lat: 48.85, Lng: 2}, []string{})
+	test("geo:\n  lat: 48.85\n  lon: 2.35", &core.Geo{Lat: 48.85, Lng: 2.35}, []string{})
+
+	test("location: Paris", nil, []string{`the location "Paris" is not a valid lat,lng coordinate`})
+	test(`location: "91,2.35"`, nil, []string{`the location "91,2.35" is not a valid lat,lng coordinate`})
+	test("geo: {lat: 48.85}", nil, []string{`the geo "map[lat:48.85]" is not a valid lat,lng coordinate`})
+}
+
+func TestParseCreatedDate(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	assert.Nil(t, err)
+
+	test := func(frontmatter string, loc *time.Location, created time.Time, offset int) {
+		content := parseWithOptions(t, "---\n"+frontmatter+"\n---\n\n# Title", ParserOpts{TimeZone: loc})
+		assert.Equal(t, content.Created, created)
+		assert.Equal(t, content.CreatedUTC, created.UTC())
+		_, actualOffset := content.Created.Zone()
+		assert.Equal(t, actualOffset, offset)
+		assert.Equal(t, content.CreatedUTC.Location(), time.UTC)
+	}
+
+	test(`created: "2021-03-04T10:00:00+02:00"`, nil, time.Date(2021, 3, 4, 8, 0, 0, 0, time.UTC), 2*60*60)
+	test(`date: "2021-03-04T10:00:00Z"`, nil, time.Date(2021, 3, 4, 10, 0, 0, 0, time.UTC), 0)
+	// The offset is kept regardless of the default time zone.
+	test(`created: "2021-03-04T10:00:00-05:00"`, paris, time.Date(2021, 3, 4, 15, 0, 0, 0, time.UTC), -5*60*60)
+
+	// Dates without offset are in the default time zone.
+	test(`created: "2021-03-04"`, nil, time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC), 0)
+	test(`created: "2021-03-04"`, paris, time.Date(2021, 3, 4, 0, 0, 0, 0, paris), 60*60)
+	test(`created: "2021-03-04T10:00:00"`, paris, time.Date(2021, 3, 4, 10, 0, 0, 0, paris), 60*60)
+	test(`created: "2021-07-04 10:00"`, paris, time.Date(2021, 7, 4, 10, 0, 0, 0, paris), 2*60*60)
+
+	content := parseWithOptions(t, "# Title", ParserOpts{})
+	assert.Equal(t, content.Created, time.Time{})
+	assert.Equal(t, content.CreatedUTC, time.Time{})
+}
+
+func TestParseRelativeDates(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	assert.Nil(t, err)
+	now := func() time.Time { return time.Date(2021, 3, 4, 23, 30, 0, 0, time.UTC) }
+
+	test := func(frontmatter string, options ParserOpts, created time.Time, warnings []string) {
+		options.Now = now
+		content := parseWithOptions(t, "---\n"+frontmatter+"\n---\n\n# Title", options)
+		assert.Equal(t, content.Created, created)
+		assert.Equal(t, content.Warnings, warnings)
+	}
+
+	test("created: today", ParserOpts{}, time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC), []string{})
+	test("created: Yesterday", ParserOpts{}, time.Date(2021, 3, 3, 0, 0, 0, 0, time.UTC), []string{})
+	test("created: tomorrow", ParserOpts{}, time.Date(2021, 3, 5, 0, 0, 0, 0, time.UTC), []string{})
+	// The current day is the one of the default time zone.
+	test("created: today", ParserOpts{TimeZone: paris}, time.Date(2021, 3, 5, 0, 0, 0, 0, paris), []string{})
+	test("created: aujourd'hui", ParserOpts{RelativeDates: map[string]int{"aujourd'hui": 0}}, time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC), []string{})
+
+	// ISO week dates start on Monday.
+	test("created: 2021-W10", ParserOpts{}, time.Date(2021, 3, 8, 0, 0, 0, 0, time.UTC), []string{})
+	test("created: 2021-W10-3", ParserOpts{}, time.Date(2021, 3, 10, 0, 0, 0, 0, time.UTC), []string{})
+	test("created: 2020W01", ParserOpts{}, time.Date(2019, 12, 30, 0, 0, 0, 0, time.UTC), []string{})
+	test("created: 2020-W53", ParserOpts{}, time.Date(2020, 12, 28, 0, 0, 0, 0, time.UTC), []string{})
+
+	test("created: someday", ParserOpts{}, time.Time{}, []string{`the created "someday" is not a valid date`})
+	test("created: 2021-W53", ParserOpts{}, time.Time{}, []string{`the created "2021-W53" is not a valid date`})
+	test("created: today", ParserOpts{RelativeDates: map[string]int{}}, time.Time{}, []string{`the created "today" is not a valid date`})
+
+	// Custom parsers are tried last.
+	test("created: someday", ParserOpts{
+		DateParsers: []DateParser{
+			func(value string, now time.Time, loc *time.Location) (time.Time, bool) {
+				return now.AddDate(1, 0, 0), value == "someday"
+			},
+		},
+	}, time.Date(2022, 3, 4, 23, 30, 0, 0, time.UTC), []string{})
+}
+
+func TestParseModifiedDate(t *testing.T) {
+	test := func(source string, expected time.Time, warnings []string) {
+		content := parseWithOptions(t, source, ParserOpts{
+			FooterDatePrefix:  "Last updated:",
+			FooterDateLayouts: []string{"2006-01-02", "January 2, 2006"},
+		})
+		assert.Equal(t, content.Modified, expected)
+		assert.Equal(t, content.Warnings, warnings)
+	}
+
+	test("# Title\n\nBody", time.Time{}, []string{})
+	test("# Title\n\nBody\n\nLast updated: 2021-05-01\n", time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC), []string{})
+	test("# Title\n\nBody\n\nlast updated:   May 3, 2021\n\n-- Signature\n", time.Date(2021, 5, 3, 0, 0, 0, 0, time.UTC), []string{})
+	test("# Title\n\nBody\n\nLast updated: yesterday", time.Time{}, []string{"the footer date can't be parsed"})
+	// The frontmatter takes precedence over the footer.
+	test("---\nmodified: 2022-01-02\n---\n\nBody\n\nLast updated: 2021-05-01", time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC), []string{})
+
+	// The footer is ignored by default.
+	content := parse(t, "Body\n\nLast updated: 2021-05-01")
+	assert.Equal(t, content.Modified, time.Time{})
+}
+
+func TestParseUnterminatedFrontmatter(t *testing.T) {
+	content := parse(t, `---
+title: A title
+tags: [tag1, tag2]
+`)
+	assert.Equal(t, content.Title, opt.NewString("A title"))
+	assert.Equal(t, content.Body, opt.NullString)
+	assert.Equal(t, content.Tags, []string{"tag1", "tag2"})
+	assert.Equal(t, content.Metadata, map[string]interface{}{
+		"title": "A title",
+		"tags":  []interface{}{"tag1", "tag2"},
+	})
+	assert.Equal(t, content.Warnings, []string{"the frontmatter closing fence is missing"})
+
+	// Falls back on the body when the YAML can't be decoded.
+	content = parse(t, `---
+Not: a: *valid YAML
+`)
+	assert.Equal(t, content.Body, opt.NewString("---\nNot: a: *valid YAML"))
+	assert.Equal(t, content.Metadata, map[string]interface{}{})
+	assert.Equal(t, content.Warnings, []string{})
+
+	// A single thematic break is not a frontmatter.
+	content = parse(t, "---\n\nParagraph")
+	assert.Equal(t, content.Body, opt.NewString("---\n\nParagraph"))
+	assert.Equal(t, content.Warnings, []string{})
+}
+
+func TestParseUnclosedCodeFence(t *testing.T) {
+	test := func(source string, expectedWarnings []string, expectedTags []string) {
+		content := parse(t, source)
+		assert.Equal(t, content.Warnings, expectedWarnings)
+		assert.Equal(t, content.Tags, expectedTags)
+	}
+
+	warning := []string{"the closing fence of a code block is missing"}
+
+	test("# Title\n\n```\ncode\n```\n\nA #tag", []string{}, []string{"tag"})
+	test("# Title\n\n```go\ncode\n```\n", []string{}, []string{})
+	test("# Title\n\n~~~\n~~~", []string{}, []string{})
+	test("# Title\n\n> ```\n> code\n\nA #tag", []string{}, []string{"tag"})
+	// The tags after the opening fence are not extracted.
+	test("# Title\n\nA #tag\n\n```go\ncode\n\nA #lost tag\n", warning, []string{"tag"})
+	test("# Title\n\n~~~\ncode\n```\n\n", warning, []string{})
+	test("# Title\n\n```", warning, []string{})
+	test("# Title\n\n```\n", warning, []string{})
+}
+
+func TestParseInlineFields(t *testing.T) {
+	test := func(source string, expectedFields map[string][]string) {
+		content := parseWithOptions(t, source, ParserOpts{
+			InlineFieldsEnabled: true,
+		})
+		assert.Equal(t, content.InlineMetadata, expectedFields)
+	}
+
+	test("", map[string][]string{})
+	test("No fields: around here", map[string][]string{})
+	test("priority:: high", map[string][]string{"priority": {"high"}})
+	test("Priority::   high  ", map[string][]string{"priority": {"high"}})
+	test("priority:: high, see https://example.com", map[string][]string{"priority": {"high, see https://example.com"}})
+	test("A [status:: active] and (due:: tomorrow) field.", map[string][]string{
+		"status": {"active"},
+		"due":    {"tomorrow"},
+	})
+	test("tag:: one\ntag:: two", map[string][]string{"tag": {"one", "two"}})
+	// Not an inline field
+	test("std::string", map[string][]string{})
+	test("`code:: span`", map[string][]string{})
+	test("key::", map[string][]string{})
+
+	// Disabled by default
+	content := parse(t, "priority:: high")
+	assert.Equal(t, content.InlineMetadata, map[string][]string{})
+}
+
+func parse(t *testing.T, source string) core.NoteContent {
+	return parseWithOptions(t, source, ParserOpts{
+		HashtagEnabled:      true,
+		MultiWordTagEnabled: true,
+		ColontagEnabled:     true,
+	})
+}
+
+func parseWithOptions(t *testing.T, source string, options ParserOpts) core.NoteContent {
+	content, err := NewParser(options, &util.NullLogger).ParseNoteContent(source)
+	assert.Nil(t, err)
+	return *content
+}
+
+func TestParseDetectedLanguage(t *testing.T) {
+	test := func(opts ParserOpts, source string, lang opt.String, minConfidence float64) {
+		content := parseWithOptions(t, source, opts)
+		assert.Equal(t, content.DetectedLang, lang)
+		assert.True(t, content.DetectedLangConfidence >= minConfidence)
+	}
+
+	english := `# A note
+
+The quick brown fox jumps over the lazy dog, and it was not amused by this.
+We have seen that the dog is sleeping in the garden with the cat.
+`
+	french := `# Une note
+
+Le renard brun saute par-dessus le chien paresseux, et il ne dort pas.
+Nous avons vu que la chatte est dans le jardin avec les enfants du voisin.
+`
+
+	// Disabled by default.
+	test(ParserOpts{}, english, opt.NullString, 0)
+
+	opts := ParserOpts{LanguageDetectionEnabled: true}
+	test(opts, english, opt.NewString("en"), 0.5)
+	test(opts, french, opt.NewString("fr"), 0.5)
+	// Too short to be conclusive.
+	test(opts, "# Title\n\nHello world", opt.NullString, 0)
+}
+
+func TestParseColor(t *testing.T) {
+	test := func(source string, color opt.String, warnings []string) {
+		content := parse(t, source)
+		assert.Equal(t, content.Color, color)
+		assert.Equal(t, content.Warnings, warnings)
+	}
+
+	test("# Title", opt.NullString, []string{})
+	test("---\ncolor: \"#ff8800\"\n---\n# Title", opt.NewString("#ff8800"), []string{})
+	test("---\ncolor: \"#F80\"\n---\n# Title", opt.NewString("#F80"), []string{})
+	test("---\ncolor: \"#ff880080\"\n---\n# Title", opt.NewString("#ff880080"), []string{})
+	test("---\nColor: RebeccaPurple\n---\n# Title", opt.NewString("RebeccaPurple"), []string{})
+	// Invalid colors are kept, with a warning.
+	test("---\ncolor: shiny\n---\n# Title", opt.NewString("shiny"), []string{`the color "shiny" is not a valid CSS color`})
+	test("---\ncolor: \"#ggg\"\n---\n# Title", opt.NewString("#ggg"), []string{`the color "#ggg" is not a valid CSS color`})
+
+	content := parseWithOptions(t, "---\naccent: teal\n---\n# Title", ParserOpts{ColorKeys: []string{"accent"}})
+	assert.Equal(t, content.Color, opt.NewString("teal"))
+}
+
+func TestParseLists(t *testing.T) {
+	test := func(source string, lists []core.List) {
+		content := parseWithOptions(t, source, ParserOpts{ListsEnabled: true})
+		assert.Equal(t, content.Lists, lists)
+	}
+
+	test("# Title\n\nNo list.", []core.List{})
+
+	test(`# Title
+
+- [ ] Groceries
+  - [x] Milk
+  - [ ] Eggs
+    * Organic
+- [ ] Code
+  `+"```go"+`
+  fmt.Println("hi")
+  `+"```"+`
+
+Paragraph.
+
+1. First
+2. Second
+`, []core.List{
+		{
+			Text:    "- [ ] Groceries\n  - [x] Milk\n  - [ ] Eggs\n    * Organic\n- [ ] Code\n  ```go\n  fmt.Println(\"hi\")\n  ```",
+			Ordered: false,
+			Depth:   3,
+		},
+		{
+			Text:    "1. First\n2. Second",
+			Ordered: true,
+			Depth:   1,
+		},
+	})
+
+	// Disabled by default.
+	content := parse(t, "# Title\n\n- Item")
+	assert.Equal(t, len(content.Lists), 0)
+}
+
+func TestParseImages(t *testing.T) {
+	test := func(source string, images []core.Image) {
+		content := parse(t, source)
+		assert.Equal(t, content.Images, images)
+	}
+
+	test("# Title\n\nNo image.", []core.Image{})
+
+	test(`# Title
+
+An ![inline](cat.png) image and an <img src="dog.png" alt="A &quot;dog&quot;"> tag.
+
+<div>
+  <IMG alt='Bird' SRC='bird.jpg' />
+  <img src=fish.gif>
+  <img alt="No source">
+  <img src="broken.png"
+</div>
+`, []core.Image{
+		{Src: "cat.png", Alt: "inline"},
+		{Src: "dog.png", Alt: `A "dog"`, HTML: true},
+		{Src: "bird.jpg", Alt: "Bird", HTML: true},
+		{Src: "fish.gif", HTML: true},
+	})
+}
+
+func TestParseLinkPositions(t *testing.T) {
+	test := func(opts ParserOpts, source string, positions [][3]int) {
+		content := parseWithOptions(t, source, opts)
+		actual := [][3]int{}
+		for _, link := range content.Links {
+			actual = append(actual, [3]int{link.Line, link.Column, link.VisualColumn})
+		}
+		assert.Equal(t, actual, positions)
+	}
+
+	source := "# Title\n\nA\t[link](target)\n\n- \t[[wiki]] and\n\t\t<https://example.com> \\\n  and [**bold**](bold)"
+
+	// Disabled by default.
+	test(ParserOpts{}, source, [][3]int{{0, 0, 0}, {0, 0, 0}, {0, 0, 0}, {0, 0, 0}})
+
+	test(ParserOpts{LinkPositionsEnabled: true}, source, [][3]int{
+		{3, 3, 5},
+		{5, 4, 5},
+		{6, 3, 9},
+		{7, 7, 7},
+	})
+	test(ParserOpts{LinkPositionsEnabled: true, TabWidth: 8}, source, [][3]int{
+		{3, 3, 9},
+		{5, 4, 9},
+		{6, 3, 17},
+		{7, 7, 7},
+	})
+}
+
+func TestParseAnchors(t *testing.T) {
+	test := func(source string, expected []string) {
+		content := parseWithOptions(t, source, ParserOpts{})
+		assert.Equal(t, content.Anchors, expected)
+	}
+
+	test("Body", []string{})
+	test(`# A title
+
+A paragraph with an <a id="sec"></a>anchor.
+
+<a name='other section'></a>
+
+## Section
+
+<div>
+  <A NAME=legacy href="#sec">Legacy</A>
+  <span id="not-an-anchor"></span>
+</div>
+
+`+"```html\n<a id=\"in-code\"></a>\n```", []string{"a-title", "sec", "other section", "section", "legacy"})
+	// Duplicates are removed.
+	test("# Section\n\n<a id=\"section\"></a>", []string{"section"})
+}
+
+func TestParseLinkHeadingPaths(t *testing.T) {
+	test := func(opts ParserOpts, source string, paths [][]string) {
+		content := parseWithOptions(t, source, opts)
+		actual := [][]string{}
+		for _, link := range content.Links {
+			actual = append(actual, link.HeadingPath)
+		}
+		assert.Equal(t, actual, paths)
+	}
+
+	source := `[[root]]
+
+# A
+
+[[under a]]
+
+## B
+
+Text with [[under b]] and [a link](target)
+
+### C
+
+#### D
+
+[[under d]]
+
+## E [[in e]] link
+
+[[under e]]`
+
+	// Disabled by default.
+	test(ParserOpts{}, source, [][]string{nil, nil, nil, nil, nil, nil, nil})
+
+	test(ParserOpts{LinkHeadingPathsEnabled: true}, source, [][]string{
+		{},
+		{"A"},
+		{"A", "B"},
+		{"A", "B"},
+		{"A", "B", "C", "D"},
+		{"A", "E in e link"},
+		{"A", "E in e link"},
+	})
+}
+
+func TestParseChildLinks(t *testing.T) {
+	test := func(opts ParserOpts, source string, hrefs []string) {
+		content := parseWithOptions(t, source, opts)
+		actual := []string{}
+		for _, link := range content.ChildLinks {
+			actual = append(actual, link.Href)
+		}
+		assert.Equal(t, actual, hrefs)
+	}
+
+	source := `# Index
+
+An introduction linking to [[intro]].
+
+- [[Zebra]]
+- [[Apple]], see also [a link](other)
+  - [[Nested]]
+- [[Mango]]
+
+- [[Loose]]
+`
+
+	// Disabled by default.
+	test(ParserOpts{}, source, []string{})
+
+	test(ParserOpts{ChildLinksEnabled: true}, source, []string{"Zebra", "Apple", "Nested", "Mango", "Loose"})
+
+	// Only the first list is considered.
+	test(ParserOpts{ChildLinksEnabled: true}, "# Index\n\n* [[Zebra]]\n* [[Apple]]\n* [[Mango]]\n\nText\n\n* [[Outside]]", []string{"Zebra", "Apple", "Mango"})
+
+	test(ParserOpts{ChildLinksEnabled: true}, "# Index\n\nWithout a list [[link]]", []string{})
+}
+
+func TestParseLenientFrontmatter(t *testing.T) {
+	source := `---
+title: A title
+description: Oops: not quoted
+tags: [a, b]
+# A comment
+
+author:
+  name: Alice
+draft: true
+---
+
+Body`
+
+	_, err := NewParser(ParserOpts{}, &util.NullLogger).ParseNoteContent(source)
+	assert.NotNil(t, err)
+
+	content := parseWithOptions(t, source, ParserOpts{LenientFrontmatter: true})
+	assert.Equal(t, content.Title, opt.NewString("A title"))
+	assert.Equal(t, content.Tags, []string{"a", "b"})
+	assert.Equal(t, content.Body, opt.NewString("Body"))
+	assert.Equal(t, content.Metadata, map[string]interface{}{
+		"title": "A title",
+		"tags":  []interface{}{"a", "b"},
+		"draft": true,
+	})
+	assert.Equal(t, content.Warnings, []string{
+		`the frontmatter line "description: Oops: not quoted" can't be decoded`,
+		`the frontmatter line "author:" can't be decoded`,
+		`the frontmatter line "  name: Alice" can't be decoded`,
+	})
+
+	// A valid frontmatter is decoded as usual.
+	content = parseWithOptions(t, "---\nauthor:\n  name: Alice\n---\n\nBody", ParserOpts{LenientFrontmatter: true})
+	assert.Equal(t, content.Metadata, map[string]interface{}{
+		"author": map[string]interface{}{"name": "Alice"},
+	})
+	assert.Equal(t, content.Warnings, []string{})
+}
+
+func TestParseWithFrontmatterDisabled(t *testing.T) {
+	source := "---\ntitle: From frontmatter\ntags: [tag1]\n---\n\n# From heading\n\nBody"
+
+	content := parseWithOptions(t, source, ParserOpts{FrontmatterDisabled: true})
+	assert.Equal(t, content.Title, opt.NewString("From heading"))
+	assert.Equal(t, content.Body, opt.NewString(source))
+	assert.Equal(t, content.Tags, []string{})
+	assert.Equal(t, content.Metadata, map[string]interface{}{})
+	assert.Equal(t, content.FrontmatterFormat, core.FrontmatterFormat(""))
+
+	// The fences are kept verbatim.
+	source = "---yaml\ntitle: A title\n...\n\n# Heading"
+	content = parseWithOptions(t, source, ParserOpts{FrontmatterDisabled: true})
+	assert.Equal(t, content.Body, opt.NewString(source))
+
+	content = parseWithOptions(t, source, ParserOpts{})
+	assert.Equal(t, content.Title, opt.NewString("A title"))
+	assert.Equal(t, content.Body, opt.NewString("# Heading"))
+}
+
+func TestParseWithByteOrderMark(t *testing.T) {
+	test := func(source string, opts ParserOpts, title string, body string) {
+		content := parseWithOptions(t, "\uFEFF"+source, opts)
+		assert.Equal(t, content.Title, opt.NewNotEmptyString(title))
+		assert.Equal(t, content.Body, opt.NewNotEmptyString(body))
+	}
+
+	test("---\ntitle: From frontmatter\n---\n\nBody", ParserOpts{}, "From frontmatter", "Body")
+	test("# From heading\n\nBody", ParserOpts{}, "From heading", "Body")
+	test("Body", ParserOpts{}, "", "Body")
+	test("# From heading\n\nBody", ParserOpts{FrontmatterDisabled: true}, "From heading", "# From heading\n\nBody")
+	test("Lead\n\nBody", ParserOpts{FrontmatterDisabled: true}, "", "Lead\n\nBody")
+
+	// The offsets still count the byte order mark.
+	parser := NewParser(ParserOpts{HashtagEnabled: true}, &util.NullLogger)
+	positions, err := parser.TagOccurrences("\uFEFF#tag", "tag")
+	assert.Nil(t, err)
+	assert.Equal(t, len(positions), 1)
+	assert.Equal(t, positions[0].Offset, 4)
+	assert.Equal(t, positions[0].Line, 1)
+}
+
+func TestParsePreview(t *testing.T) {
+	test := func(opts ParserOpts, source string, expected opt.String) {
+		content := parseWithOptions(t, source, opts)
+		assert.Equal(t, content.Preview, expected)
+	}
+
+	test(ParserOpts{}, "# Title", opt.NullString)
+	test(ParserOpts{}, "---\ndescription: \"  A short *summary*  \"\n---\n# Title\n\nBody", opt.NewString("A short *summary*"))
+	test(ParserOpts{}, "# Title\n\nA **short** [body](link).\n\n- With\n- a list", opt.NewString("A short body. With a list"))
+	test(ParserOpts{PreviewWordCount: 4}, "# Title\n\nOne two three\nfour five six.", opt.NewString("One two three four"))
+	test(ParserOpts{PreviewKeys: []string{"summary"}}, "---\nsummary: From summary\ndescription: Ignored\n---\n# Title\n\nBody", opt.NewString("From summary"))
+
+	words := []string{}
+	for i := 0; i < 40; i++ {
+		words = append(words, "word")
+	}
+	test(ParserOpts{}, "# Title\n\n"+strings.Join(words, " "), opt.NewString(strings.Join(words[:30], " ")))
+}
+
+func TestParseSelfEmbed(t *testing.T) {
+	test := func(selfTargets []string, source string, expected bool) {
+		content := parseWithOptions(t, "# Title\n\n"+source+"\n", ParserOpts{SelfTargets: selfTargets})
+		assert.Equal(t, content.HasSelfEmbed, expected)
+	}
+
+	test(nil, "![[This Note]]", false)
+	test([]string{"this note"}, "A normal ![[Other Note]] embed", false)
+	test([]string{"this note"}, "A link to [[This Note]]", false)
+	test([]string{"this note"}, "A self ![[This Note]] embed", true)
+	test([]string{"abc1", "this-note"}, "![[folder/This-Note.md#Heading|label]]", true)
+	test([]string{"abc1"}, "![[abc1]]", true)
+}
+
+func TestParseEmbedsAsLinks(t *testing.T) {
+	content := parse(t, "# Title\n\nAn ![[Embedded note]] and an ![image](image.png).\n")
+	assert.Equal(t, content.Links, []core.Link{
+		{
+			Title:        "Embedded note",
+			Href:         "Embedded note",
+			Type:         core.LinkTypeWikiLink,
+			Rels:         []core.LinkRelation{},
+			Snippet:      "An ![[Embedded note]] and an ![image](image.png).",
+			SnippetStart: 9,
+			SnippetEnd:   58,
+			Target:       "Embedded note",
+		},
+	})
+}
+
+func TestParseDateMentions(t *testing.T) {
+	date := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		assert.Nil(t, err)
+		return d
+	}
+	test := func(source string, dates []time.Time, earliest time.Time, latest time.Time) {
+		content := parseWithOptions(t, source, ParserOpts{DateMentionsEnabled: true})
+		assert.Equal(t, content.DateMentions, dates)
+		assert.Equal(t, content.EarliestDate, earliest)
+		assert.Equal(t, content.LatestDate, latest)
+	}
+
+	test("# Title\n\nNo date.", []time.Time{}, time.Time{}, time.Time{})
+
+	test(`# Title
+
+We met on 2021-05-01 2021-04-12, then again on *2021-05-01*.
+Not in `+"`2020-01-01`"+` nor [2019-01-01](2018-01-01.md) or [[2017-01-01]].
+
+`+"```"+`
+2016-01-01
+`+"```"+`
+
+Skipped: 05/01/2021, 2021-13-45, v2015-01-01, 2015-01-01-2, 2015/01/01.
+(2022-02-28)
+`, []time.Time{date("2021-05-01"), date("2021-04-12"), date("2022-02-28")}, date("2021-04-12"), date("2022-02-28"))
+
+	// Disabled by default.
+	content := parse(t, "# Title\n\nOn 2021-05-01.")
+	assert.Equal(t, content.DateMentions, []time.Time{})
+}
+
+func TestParseRequireTitle(t *testing.T) {
+	test := func(source string, expectedErr error) {
+		content, err := NewParser(ParserOpts{RequireTitle: true}, &util.NullLogger).ParseNoteContent(source)
+		assert.Equal(t, err, expectedErr)
+		assert.Equal(t, content == nil, expectedErr != nil)
+	}
+
+	test("# A title\n\nBody", nil)
+	test("---\ntitle: A title\n---\n\nBody", nil)
+	test("Body", ErrNoTitle)
+	test("---\ntitle: \" \"\n---\n\n#\n\nBody", ErrNoTitle)
+
+	// Disabled by default.
+	content := parse(t, "Body")
+	assert.Equal(t, content.Title, opt.NullString)
+}
+
+func TestParseRelationLinks(t *testing.T) {
+	content := parseWithOptions(t, `---
+contradicts: [[A]]
+Supports:
+  - "[[B|The B note]]"
+  - [[C]]
+  - folder/d.md
+see-also: "[[E]]"
+---
+
+# Title
+`, ParserOpts{
+		RelationKeys: map[string]string{"contradicts": "contradicts", "supports": "supports"},
+	})
+
+	assert.Equal(t, content.Links, []core.Link{
+		{
+			Href:   "A",
+			Type:   core.LinkTypeWikiLink,
+			Rels:   core.LinkRels("contradicts"),
+			Target: "A",
+		},
+		{
+			Title:  "The B note",
+			Href:   "B",
+			Type:   core.LinkTypeWikiLink,
+			Rels:   core.LinkRels("supports"),
+			Target: "B",
+		},
+		{
+			Href:   "C",
+			Type:   core.LinkTypeWikiLink,
+			Rels:   core.LinkRels("supports"),
+			Target: "C",
+		},
+		{
+			Href:   "folder/d.md",
+			Type:   core.LinkTypeMarkdown,
+			Rels:   core.LinkRels("supports"),
+			Target: "folder/d",
+			Ext:    "md",
+		},
+	})
+}
+
+func TestParseReferenceLinks(t *testing.T) {
+	content := parse(t, `# Title
+
+A [full][Ref], [collapsed][] and [dangling][missing] reference.
+Escaped \[not][a ref], `+"`[in][code]`"+` and [again][MISSING].
+
+[ref]: https://example.com
+[collapsed]: note.md
+`)
+
+	assert.Equal(t, len(content.Links), 2)
+	assert.Equal(t, content.Links[0].Title, "full")
+	assert.Equal(t, content.Links[0].Href, "https://example.com")
+	assert.Equal(t, content.Links[1].Title, "collapsed")
+	assert.Equal(t, content.Links[1].Href, "note.md")
+	assert.Equal(t, content.Warnings, []string{
+		`the link reference "missing" is not defined`,
+	})
+}
+
+func TestParseInDocumentOrder(t *testing.T) {
+	content := parse(t, `---
+up: "[[Index]]"
+tags: [b, a]
+---
+
+# Title
+
+An ![image](1.png) [link](one) #c and <img src="2.png"> [[two]].
+
+- Item with ![[embed]] #a and ![second](3.png)
+- <https://three.com> #d
+`)
+
+	hrefs := []string{}
+	for _, link := range content.Links {
+		hrefs = append(hrefs, link.Href)
+	}
+	assert.Equal(t, hrefs, []string{"Index", "one", "two", "embed", "https://three.com"})
+
+	srcs := []string{}
+	for _, image := range content.Images {
+		srcs = append(srcs, image.Src)
+	}
+	assert.Equal(t, srcs, []string{"1.png", "2.png", "3.png"})
+
+	assert.Equal(t, content.Tags, []string{"b", "a", "c", "d"})
+}
+
+func TestTagOccurrences(t *testing.T) {
+	test := func(source string, tag string, expected []core.Position) {
+		parser := NewParser(ParserOpts{
+			HashtagEnabled:      true,
+			MultiWordTagEnabled: true,
+			ColontagEnabled:     true,
+		}, &util.NullLogger)
+		positions, err := parser.TagOccurrences(source, tag)
+		assert.Nil(t, err)
+		assert.Equal(t, positions, expected)
+		// The positions can be used to edit the tags in place.
+		for _, pos := range positions {
+			assert.Equal(t, source[pos.Offset:pos.Offset+len(tag)], tag)
+		}
+	}
+
+	source := `---
+title: Été
+tags: [draft, "été", '#draft']
+---
+
+# Été #draft
+
+A #draft note with a #multi word# tag and :work:draft:.
+Not #drafts, nor ` + "`#draft`" + `, nor #dr\aft, nor draft.`
+
+	test(source, "draft", []core.Position{
+		{Offset: 24, Line: 3, Column: 8},
+		{Offset: 42, Line: 3, Column: 24},
+		{Offset: 64, Line: 6, Column: 8},
+		{Offset: 74, Line: 8, Column: 4},
+		{Offset: 119, Line: 8, Column: 49},
+	})
+	test(source, "été", []core.Position{{Offset: 32, Line: 3, Column: 16}})
+	test(source, "multi word", []core.Position{{Offset: 93, Line: 8, Column: 23}})
+	test(source, "unknown", []core.Position{})
+
+	// Block lists and space-separated strings.
+	test("---\ntags:\n  - draft\n  - \"#work\"\nkeywords: work:2 draft\n---\n\nBody", "work", []core.Position{
+		{Offset: 26, Line: 4, Column: 7},
+		{Offset: 42, Line: 5, Column: 11},
+	})
+	test("---\nTags: work draft\n---\n\nBody", "draft", []core.Position{{Offset: 15, Line: 2, Column: 12}})
+
+	// Wiki links written with fullwidth brackets don't shift the offsets.
+	test("A ［［link］］ and #draft, then ［［other］］ #draft", "draft", []core.Position{
+		{Offset: 24, Line: 1, Column: 17},
+		{Offset: 55, Line: 1, Column: 40},
+	})
+}
+
+func TestParseTagsCallback(t *testing.T) {
+	type reported struct {
+		Tag string
+		Pos core.Position
+	}
+
+	test := func(opts ParserOpts, source string, expected []reported, tags []string) {
+		actual := []reported{}
+		opts.HashtagEnabled = true
+		opts.ColontagEnabled = true
+		opts.MinTagLength = 2
+		opts.OnTag = func(tag string, pos core.Position) {
+			actual = append(actual, reported{tag, pos})
+		}
+		content := parseWithOptions(t, source, opts)
+		assert.Equal(t, actual, expected)
+		assert.Equal(t, content.Tags, tags)
+	}
+
+	source := "---\ntags: [fm]\n---\n\n# Title\n\nÉté #summer and #a\n  :one:two: #summer"
+
+	test(ParserOpts{}, source, []reported{
+		{"fm", core.Position{}},
+		{"summer", core.Position{Offset: 35, Line: 7, Column: 5}},
+		{"one", core.Position{Offset: 52, Line: 8, Column: 3}},
+		{"two", core.Position{Offset: 52, Line: 8, Column: 3}},
+		{"summer", core.Position{Offset: 62, Line: 8, Column: 13}},
+	}, []string{"fm", "summer", "one", "two"})
+
+	test(ParserOpts{TagsCallbackOnly: true}, source, []reported{
+		{"fm", core.Position{}},
+		{"summer", core.Position{Offset: 35, Line: 7, Column: 5}},
+		{"one", core.Position{Offset: 52, Line: 8, Column: 3}},
+		{"two", core.Position{Offset: 52, Line: 8, Column: 3}},
+		{"summer", core.Position{Offset: 62, Line: 8, Column: 13}},
+	}, []string{})
 }
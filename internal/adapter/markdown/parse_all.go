@@ -0,0 +1,109 @@
+package markdown
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/yuin/goldmark/parser"
+	"github.com/zk-org/zk/internal/core"
+)
+
+// ParseAll parses the content of many notes in parallel, with at most
+// concurrency workers. When concurrency is not positive, one worker per CPU
+// is used. The parser contexts are pooled across the notes.
+//
+// The results and errors are indexed by the keys of sources. When the
+// context is cancelled, the sources which were not parsed yet fail with the
+// context error.
+func (p *Parser) ParseAll(ctx context.Context, sources map[string]string, concurrency int) (map[string]*core.NoteContent, map[string]error) {
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+
+	results := map[string]*core.NoteContent{}
+	errs := map[string]error{}
+	var mutex sync.Mutex
+
+	keys := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keys {
+				var content *core.NoteContent
+				err := ctx.Err()
+				if err == nil {
+					pc := acquireContext()
+					content, err = p.parseNoteContentWithContext(sources[key], pc)
+					releaseContext(pc)
+				}
+
+				mutex.Lock()
+				if err != nil {
+					errs[key] = err
+				} else {
+					results[key] = content
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	pending := make([]string, 0, len(sources))
+	for key := range sources {
+		pending = append(pending, key)
+	}
+	for i, key := range pending {
+		if ctx.Err() == nil {
+			select {
+			case keys <- key:
+				continue
+			case <-ctx.Done():
+			}
+		}
+		// The remaining sources are not dispatched once cancelled.
+		mutex.Lock()
+		for _, key := range pending[i:] {
+			errs[key] = ctx.Err()
+		}
+		mutex.Unlock()
+		break
+	}
+	close(keys)
+	wg.Wait()
+
+	return results, errs
+}
+
+// contextPool holds the parser contexts reused by ParseAll.
+var contextPool = sync.Pool{
+	New: func() interface{} {
+		return parser.NewContext()
+	},
+}
+
+// acquireContext returns a blank parser context from the pool.
+func acquireContext() parser.Context {
+	return contextPool.Get().(parser.Context)
+}
+
+// releaseContext blanks out the given parser context and returns it to the
+// pool.
+//
+// The link reference definitions can't be removed from a context, so one
+// holding any is dropped instead. The element IDs are not reset, as the
+// parser doesn't generate any.
+func releaseContext(pc parser.Context) {
+	if len(pc.References()) > 0 {
+		return
+	}
+	for key := parser.ContextKey(0); key <= parser.ContextKeyMax; key++ {
+		pc.Set(key, nil)
+	}
+	pc.SetBlockOffset(-1)
+	pc.SetBlockIndent(-1)
+	pc.SetOpenedBlocks([]parser.Block{})
+	contextPool.Put(pc)
+}
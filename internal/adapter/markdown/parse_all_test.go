@@ -0,0 +1,108 @@
+package markdown
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/zk-org/zk/internal/util"
+	"github.com/zk-org/zk/internal/util/opt"
+	"github.com/zk-org/zk/internal/util/test/assert"
+)
+
+func TestParseAll(t *testing.T) {
+	sources := map[string]string{}
+	for i := 0; i < 20; i++ {
+		sources[fmt.Sprintf("note%d.md", i)] = fmt.Sprintf("# Note %d\n\nBody #tag%d", i, i)
+	}
+
+	parser := NewParser(ParserOpts{HashtagEnabled: true}, &util.NullLogger)
+	results, errs := parser.ParseAll(context.Background(), sources, 4)
+
+	assert.Equal(t, len(errs), 0)
+	assert.Equal(t, len(results), len(sources))
+	for i := 0; i < 20; i++ {
+		content := results[fmt.Sprintf("note%d.md", i)]
+		assert.Equal(t, content.Title, opt.NewString(fmt.Sprintf("Note %d", i)))
+		assert.Equal(t, content.Tags, []string{fmt.Sprintf("tag%d", i)})
+	}
+}
+
+func TestParseAllWithCancelledContext(t *testing.T) {
+	sources := map[string]string{
+		"a.md": "# A",
+		"b.md": "# B",
+		"c.md": "# C",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Cancels the context while parsing the first note.
+	parser := NewParser(ParserOpts{
+		Visitors: []func(n ast.Node, entering bool, source []byte){
+			func(n ast.Node, entering bool, source []byte) { cancel() },
+		},
+	}, &util.NullLogger)
+	results, errs := parser.ParseAll(ctx, sources, 1)
+
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, len(errs), 2)
+	for key, err := range errs {
+		_, parsed := results[key]
+		assert.False(t, parsed)
+		assert.Equal(t, err, context.Canceled)
+	}
+}
+
+func TestParseAllWithCancelledContextDoesntDispatch(t *testing.T) {
+	sources := map[string]string{"a.md": "# A", "b.md": "# B"}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	parsed := false
+	parser := NewParser(ParserOpts{
+		Visitors: []func(n ast.Node, entering bool, source []byte){
+			func(n ast.Node, entering bool, source []byte) { parsed = true },
+		},
+	}, &util.NullLogger)
+	results, errs := parser.ParseAll(ctx, sources, 1)
+
+	assert.False(t, parsed)
+	assert.Equal(t, len(results), 0)
+	assert.Equal(t, errs, map[string]error{"a.md": context.Canceled, "b.md": context.Canceled})
+}
+
+func TestParseAllReusesBlankContexts(t *testing.T) {
+	sources := map[string]string{}
+	for i := 0; i < 20; i++ {
+		switch i % 3 {
+		case 0:
+			sources[fmt.Sprintf("note%d.md", i)] = "---\ntitle: Meta\n---\n\nBody"
+		case 1:
+			sources[fmt.Sprintf("note%d.md", i)] = "# Ref\n\nA [link][ref].\n\n[ref]: target.md"
+		default:
+			sources[fmt.Sprintf("note%d.md", i)] = "# Plain\n\nA [link][ref]."
+		}
+	}
+
+	parser := NewParser(ParserOpts{}, &util.NullLogger)
+	results, errs := parser.ParseAll(context.Background(), sources, 1)
+
+	assert.Equal(t, len(errs), 0)
+	for i := 0; i < 20; i++ {
+		content := results[fmt.Sprintf("note%d.md", i)]
+		switch i % 3 {
+		case 0:
+			assert.Equal(t, content.Metadata, map[string]interface{}{"title": "Meta"})
+		case 1:
+			assert.Equal(t, len(content.Links), 1)
+		default:
+			// Neither the frontmatter nor the references of the previous
+			// notes leak into this one.
+			assert.Equal(t, content.Metadata, map[string]interface{}{})
+			assert.Equal(t, len(content.Links), 0)
+		}
+	}
+}
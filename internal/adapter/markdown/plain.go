@@ -0,0 +1,185 @@
+package markdown
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/zk-org/zk/internal/adapter/markdown/extensions"
+)
+
+// PlainOpts holds the options used to render the body of a note as plain
+// text.
+type PlainOpts struct {
+	// Indicates whether headings are kept as plain lines.
+	KeepHeadings bool
+	// Indicates whether the content of code blocks is kept.
+	KeepCode bool
+	// Indicates whether list items are prefixed with their marker, e.g. `-`
+	// or `1.`.
+	KeepListMarkers bool
+	// Indicates whether the line breaks of paragraphs are collapsed into
+	// spaces, including the hard line breaks written with two trailing
+	// spaces or a backslash. By default, they are kept as newlines.
+	//
+	// This doesn't affect the raw Markdown body of the note content.
+	CollapseBreaks bool
+}
+
+// PlainBody renders the body of the given note content as plain text, for
+// example to feed an embedding model.
+//
+// The frontmatter, title and any Markdown markup are stripped. Links are
+// replaced by their label.
+func (p *Parser) PlainBody(content string, opts PlainOpts) (string, error) {
+	source, fence := p.prepareSource(content)
+	context := parser.NewContext()
+	root := p.md.Parser().Parse(text.NewReader(source), parser.WithContext(context))
+
+	frontmatter, err := parseFrontmatter(context, source, fence, p.options.CaseSensitiveKeys, p.options.LenientFrontmatter)
+	if err != nil {
+		return "", err
+	}
+	_, _, bodyStart, err := parseTitle(frontmatter, root, source)
+	if err != nil {
+		return "", err
+	}
+
+	return plainBody(root, source, bodyStart, opts), nil
+}
+
+// plainBody renders the top-level blocks of root starting after bodyStart.
+func plainBody(root ast.Node, source []byte, bodyStart int, opts PlainOpts) string {
+	r := plainRenderer{source: source, opts: opts}
+	blocks := []string{}
+	for n := root.FirstChild(); n != nil; n = n.NextSibling() {
+		if _, end, ok := blockRange(n); ok && end <= bodyStart {
+			continue
+		}
+		if block := r.renderBlock(n, 0); block != "" {
+			blocks = append(blocks, block)
+		}
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// plainText renders the given Markdown snippet as plain text.
+func (p *Parser) plainText(source []byte) string {
+	root := p.md.Parser().Parse(text.NewReader(source))
+	r := plainRenderer{source: source}
+	return r.renderChildren(root, 0, "\n\n")
+}
+
+type plainRenderer struct {
+	source []byte
+	opts   PlainOpts
+}
+
+// renderBlock returns the plain text of a block node.
+func (r *plainRenderer) renderBlock(n ast.Node, depth int) string {
+	switch n := n.(type) {
+	case *ast.Heading:
+		if !r.opts.KeepHeadings {
+			return ""
+		}
+		return r.renderInlines(n)
+
+	case *ast.FencedCodeBlock, *ast.CodeBlock:
+		if !r.opts.KeepCode {
+			return ""
+		}
+		var buf strings.Builder
+		lines := n.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			line := lines.At(i)
+			buf.Write(line.Value(r.source))
+		}
+		return strings.TrimRight(buf.String(), "\n")
+
+	case *ast.HTMLBlock, *ast.ThematicBreak:
+		return ""
+
+	case *ast.List:
+		return r.renderList(n, depth)
+
+	case *ast.Paragraph, *ast.TextBlock:
+		return r.renderInlines(n)
+
+	default:
+		return r.renderChildren(n, depth, "\n\n")
+	}
+}
+
+// renderChildren returns the plain text of the block children of n, joined
+// with the given separator.
+func (r *plainRenderer) renderChildren(n ast.Node, depth int, sep string) string {
+	blocks := []string{}
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		if block := r.renderBlock(c, depth); block != "" {
+			blocks = append(blocks, block)
+		}
+	}
+	return strings.Join(blocks, sep)
+}
+
+func (r *plainRenderer) renderList(list *ast.List, depth int) string {
+	items := []string{}
+	number := list.Start
+	for item := list.FirstChild(); item != nil; item = item.NextSibling() {
+		marker := ""
+		if r.opts.KeepListMarkers {
+			if list.IsOrdered() {
+				marker = strconv.Itoa(number) + string(list.Marker) + " "
+				number++
+			} else {
+				marker = string(list.Marker) + " "
+			}
+		}
+
+		text := r.renderChildren(item, depth+1, "\n")
+		if marker != "" && !strings.HasPrefix(text, "\n") {
+			text = marker + text
+		}
+		items = append(items, text)
+	}
+
+	text := strings.Join(items, "\n")
+	if depth > 0 && r.opts.KeepListMarkers {
+		text = "  " + strings.ReplaceAll(text, "\n", "\n  ")
+	}
+	return text
+}
+
+// renderInlines returns the text of the inline children of the given node.
+func (r *plainRenderer) renderInlines(n ast.Node) string {
+	var buf strings.Builder
+	ast.Walk(n, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch n := n.(type) {
+		case *ast.Text:
+			buf.Write(n.Segment.Value(r.source))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				if r.opts.CollapseBreaks {
+					buf.WriteString(" ")
+				} else {
+					buf.WriteString("\n")
+				}
+			}
+		case *ast.String:
+			buf.Write(n.Value)
+		case *ast.AutoLink:
+			buf.Write(n.Label(r.source))
+		case *ast.RawHTML:
+			return ast.WalkSkipChildren, nil
+		case *extensions.Tags:
+			buf.WriteString(strings.Join(n.Tags, " "))
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(buf.String())
+}
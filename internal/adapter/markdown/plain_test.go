@@ -0,0 +1,81 @@
+package markdown
+
+import (
+	"testing"
+
+	"github.com/zk-org/zk/internal/util"
+	"github.com/zk-org/zk/internal/util/test/assert"
+)
+
+func TestPlainBody(t *testing.T) {
+	source := `---
+title: A title
+---
+
+# Heading
+
+A paragraph with a [link](target), a [[wiki link|wiki label]] and **bold** ` + "`code`" + `.
+https://example.com
+
+` + "```go\nfunc main() {}\n```" + `
+
+* item 1
+* item 2
+    1. sub-item
+
+<div>HTML</div>
+`
+
+	test := func(opts PlainOpts, expected string) {
+		parser := NewParser(ParserOpts{HashtagEnabled: true}, &util.NullLogger)
+		actual, err := parser.PlainBody(source, opts)
+		assert.Nil(t, err)
+		assert.Equal(t, actual, expected)
+	}
+
+	test(PlainOpts{}, `A paragraph with a link, a wiki label and bold code.
+https://example.com
+
+item 1
+item 2
+sub-item`)
+
+	test(PlainOpts{KeepHeadings: true}, `Heading
+
+A paragraph with a link, a wiki label and bold code.
+https://example.com
+
+item 1
+item 2
+sub-item`)
+
+	test(PlainOpts{KeepCode: true, KeepListMarkers: true}, `A paragraph with a link, a wiki label and bold code.
+https://example.com
+
+func main() {}
+
+* item 1
+* item 2
+  1. sub-item`)
+}
+
+func TestPlainBodyWithBreaks(t *testing.T) {
+	source := "# Heading\n\nA soft\nbreak, a hard  \nbreak and\\\nanother one.\n\n* An item\n  on two lines"
+
+	test := func(opts PlainOpts, expected string) {
+		parser := NewParser(ParserOpts{}, &util.NullLogger)
+		actual, err := parser.PlainBody(source, opts)
+		assert.Nil(t, err)
+		assert.Equal(t, actual, expected)
+	}
+
+	test(PlainOpts{}, "A soft\nbreak, a hard\nbreak and\nanother one.\n\nAn item\non two lines")
+	test(PlainOpts{CollapseBreaks: true}, "A soft break, a hard break and another one.\n\nAn item on two lines")
+}
+
+func TestPlainBodyWithoutFrontmatterTitle(t *testing.T) {
+	parser := NewParser(ParserOpts{}, &util.NullLogger)
+	actual, err := parser.PlainBody("# Title\n\n## Section\n\nBody", PlainOpts{KeepHeadings: true})
+	assert.Nil(t, err)
+	assert.Equal(t, actual, "Section\n\nBody")
+}
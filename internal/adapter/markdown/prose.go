@@ -0,0 +1,58 @@
+package markdown
+
+import (
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// walkProseLines calls fn with each line of prose found in the note, that is
+// the lines of paragraphs and headings. Code blocks are skipped and the
+// content of code spans is blanked out, so that syntaxes matched on the raw
+// lines are not found in code.
+//
+// start is the byte offset of the line in the source.
+func walkProseLines(root ast.Node, source []byte, fn func(line string, start int)) error {
+	return ast.Walk(root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n.Kind() {
+		case ast.KindParagraph, ast.KindTextBlock, ast.KindHeading:
+		default:
+			return ast.WalkContinue, nil
+		}
+
+		codeSpans := codeSpanSegments(n)
+		lines := n.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			seg := lines.At(i)
+			line := []byte(string(seg.Value(source)))
+			for _, code := range codeSpans {
+				for j := max(code.Start, seg.Start); j < min(code.Stop, seg.Stop); j++ {
+					line[j-seg.Start] = ' '
+				}
+			}
+			fn(string(line), seg.Start)
+		}
+
+		return ast.WalkSkipChildren, nil
+	})
+}
+
+// codeSpanSegments returns the segments of the content of the code spans
+// found in the given node.
+func codeSpanSegments(n ast.Node) []text.Segment {
+	segments := []text.Segment{}
+	ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if _, ok := c.(*ast.CodeSpan); ok && entering {
+			for t := c.FirstChild(); t != nil; t = t.NextSibling() {
+				if t, ok := t.(*ast.Text); ok {
+					segments = append(segments, t.Segment)
+				}
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return segments
+}
@@ -0,0 +1,64 @@
+package markdown
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/gosimple/slug"
+)
+
+// SlugStyle defines the rules used to generate the anchor of a heading.
+type SlugStyle string
+
+const (
+	// SlugStyleGitHub generates anchors as GitHub does, e.g. `## Foo, Bar!`
+	// -> `foo-bar`.
+	SlugStyleGitHub SlugStyle = "github"
+	// SlugStyleObsidian keeps the heading text as it is written in Obsidian
+	// links, e.g. `## Foo, Bar!` -> `Foo, Bar!`.
+	SlugStyleObsidian SlugStyle = "obsidian"
+	// SlugStylePlain generates transliterated URL slugs, e.g. `## Foo, Bar!`
+	// -> `foo-bar`.
+	SlugStylePlain SlugStyle = "plain"
+)
+
+// Slugify returns the anchor of a heading with the given text.
+func (s SlugStyle) Slugify(text string) string {
+	switch s {
+	case SlugStyleObsidian:
+		return obsidianSlug(text)
+	case SlugStylePlain:
+		return slug.Make(text)
+	default:
+		return githubSlug(text)
+	}
+}
+
+// githubSlug lowercases the text, removes any punctuation except hyphens and
+// underscores, and replaces each space with a hyphen.
+func githubSlug(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(text)) {
+		switch {
+		case r == ' ':
+			b.WriteRune('-')
+		case r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r):
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// obsidianSlug removes the characters which can't be used in an Obsidian
+// link to a heading.
+func obsidianSlug(text string) string {
+	text = strings.NewReplacer("[[", "", "]]", "", "%%", "").Replace(text)
+	text = strings.Map(func(r rune) rune {
+		switch r {
+		case '#', '|', '^', ':':
+			return -1
+		}
+		return r
+	}, text)
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,168 @@
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/zk-org/zk/internal/adapter/markdown/extensions"
+	"github.com/zk-org/zk/internal/core"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// TagOccurrences returns the positions of each occurrence of the given tag in
+// the note content, e.g. to rename it in place. The tag spans from the
+// position offset to offset+len(tag), without its # or : markers.
+//
+// Both the inline tags and the entries of the frontmatter tags are reported,
+// in the order of the note. Tags written with escaped characters are skipped,
+// as they can't be edited in place.
+func (p *Parser) TagOccurrences(content string, tag string) ([]core.Position, error) {
+	source, fence := p.prepareSource(content)
+
+	context := parser.NewContext()
+	root := p.md.Parser().Parse(
+		text.NewReader(source),
+		parser.WithContext(context),
+	)
+
+	frontmatter, err := parseFrontmatter(context, source, fence, p.options.CaseSensitiveKeys, p.options.LenientFrontmatter)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := []int{}
+	if frontmatter.end > frontmatter.start {
+		offsets = append(offsets, frontmatterTagOffsets(source[:frontmatter.end], frontmatter.start, tag, p.options.CaseSensitiveKeys)...)
+	}
+
+	err = ast.Walk(root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if tags, ok := n.(*extensions.Tags); ok && entering {
+			offsets = append(offsets, inlineTagOffsets(tags, source, tag)...)
+		}
+		return ast.WalkContinue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	positions := make([]core.Position, 0, len(offsets))
+	for _, offset := range offsets {
+		positions = append(positions, p.positionAt(offset, source))
+	}
+	return positions, nil
+}
+
+// inlineTagOffsets returns the offsets of the given tag among the tags of an
+// inline node, which are written in order on its line.
+func inlineTagOffsets(tags *extensions.Tags, source []byte, tag string) []int {
+	offsets := []int{}
+	lineEnd := len(source)
+	if i := bytes.IndexByte(source[tags.Start:], '\n'); i != -1 {
+		lineEnd = tags.Start + i
+	}
+
+	cursor := tags.Start
+	for _, t := range tags.Tags {
+		i := bytes.Index(source[cursor:lineEnd], []byte(t))
+		// A tag follows its # or : marker, otherwise it was written with
+		// escaped characters.
+		if i == -1 || (cursor+i > 0 && !strings.ContainsRune("#:", rune(source[cursor+i-1]))) {
+			continue
+		}
+		if t == tag {
+			offsets = append(offsets, cursor+i)
+		}
+		cursor += i + len(t)
+	}
+	return offsets
+}
+
+// frontmatterTagKeyRegex matches a top-level frontmatter key holding tags,
+// capturing the key and its value.
+var frontmatterTagKeyRegex = regexp.MustCompile(`^(tags?|keywords?)[ \t]*:[ \t]*(.*?)[ \t\r]*$`)
+
+// frontmatterTagKeyInsensitiveRegex is frontmatterTagKeyRegex ignoring the
+// case of the key.
+var frontmatterTagKeyInsensitiveRegex = regexp.MustCompile(`(?i)` + frontmatterTagKeyRegex.String())
+
+// frontmatterListItemRegex matches an item of a YAML block list, capturing its
+// value.
+var frontmatterListItemRegex = regexp.MustCompile(`^[ \t]*-[ \t]+(.*?)[ \t\r]*$`)
+
+// frontmatterTagOffsets returns the offsets of the given tag in the tags of
+// the frontmatter starting at start, written either as a flow list, a block
+// list or a space-separated string.
+func frontmatterTagOffsets(source []byte, start int, tag string, caseSensitive bool) []int {
+	offsets := []int{}
+
+	// Records the item found at the given offset, if it is the tag.
+	match := func(item string, offset int, isKeyword bool) {
+		trimmed := strings.TrimLeft(item, `"'#`)
+		offset += len(item) - len(trimmed)
+		trimmed = strings.TrimRight(trimmed, `"'`)
+		if isKeyword {
+			trimmed, _ = splitKeywordWeight(trimmed)
+		}
+		if trimmed == tag {
+			offsets = append(offsets, offset)
+		}
+	}
+
+	// Records the items of a value split by the given separator.
+	matchFields := func(value string, offset int, sep func(r rune) bool, isKeyword bool) {
+		for len(value) > 0 {
+			i := strings.IndexFunc(value, func(r rune) bool { return !sep(r) })
+			if i == -1 {
+				return
+			}
+			value, offset = value[i:], offset+i
+			end := strings.IndexFunc(value, sep)
+			if end == -1 {
+				end = len(value)
+			}
+			match(value[:end], offset, isKeyword)
+			value, offset = value[end:], offset+end
+		}
+	}
+
+	keyRegex := frontmatterTagKeyInsensitiveRegex
+	if caseSensitive {
+		keyRegex = frontmatterTagKeyRegex
+	}
+
+	inList, isKeyword := false, false
+	lineStart := start
+	for lineStart < len(source) {
+		lineEnd := len(source)
+		if i := bytes.IndexByte(source[lineStart:], '\n'); i != -1 {
+			lineEnd = lineStart + i
+		}
+		line := string(source[lineStart:lineEnd])
+
+		if m := keyRegex.FindStringSubmatchIndex(line); m != nil {
+			isKeyword = strings.HasPrefix(strings.ToLower(line), "keyword")
+			value, offset := line[m[4]:m[5]], lineStart+m[4]
+			inList = value == ""
+
+			if strings.HasPrefix(value, "[") {
+				value = strings.TrimSuffix(value[1:], "]")
+				matchFields(value, offset+1, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }, isKeyword)
+			} else if value != "" {
+				// A quoted string is a single space-separated value.
+				matchFields(value, offset, func(r rune) bool { return r == ' ' || r == '\t' || r == '"' || r == '\'' }, isKeyword)
+			}
+
+		} else if m := frontmatterListItemRegex.FindStringSubmatchIndex(line); inList && m != nil {
+			match(line[m[2]:m[3]], lineStart+m[2], isKeyword)
+
+		} else if line != "" && line[0] != ' ' && line[0] != '\t' {
+			inList = false
+		}
+
+		lineStart = lineEnd + 1
+	}
+	return offsets
+}
@@ -26,6 +26,29 @@ type Link struct {
 	SnippetStart int `json:"snippetStart"`
 	// End byte offset of the snippet in the note content.
 	SnippetEnd int `json:"snippetEnd"`
+	// Line number of the link in the note content, starting at 1. It is only
+	// set when the parser computes the link positions.
+	Line int `json:"line,omitempty"`
+	// Column of the link in its line, counted in characters and starting at 1.
+	Column int `json:"column,omitempty"`
+	// Column of the link in its line once tabs are expanded, starting at 1.
+	VisualColumn int `json:"visualColumn,omitempty"`
+	// Text of the headings enclosing the link, from the top-level heading
+	// down to the link's section. It is only set when enabled in the parser.
+	HeadingPath []string `json:"headingPath,omitempty"`
+	// Path of an internal link target, without its extension and fragment.
+	Target string `json:"target,omitempty"`
+	// File extension of an internal link target, without the leading dot.
+	Ext string `json:"ext,omitempty"`
+	// Fragment of an internal link target, e.g. a heading anchor.
+	Fragment string `json:"fragment,omitempty"`
+	// Lowercase form of Target, used to match notes regardless of case. It
+	// is only set when enabled in the parser.
+	NormalizedTarget string `json:"normalizedTarget,omitempty"`
+	// Indicates whether the target was found by the parser's link resolver.
+	Resolved bool `json:"resolved,omitempty"`
+	// Identifier of the target returned by the parser's link resolver.
+	ResolvedID string `json:"resolvedId,omitempty"`
 }
 
 // ResolvedLink represents a link between two indexed notes.
@@ -55,6 +78,12 @@ const (
 	LinkRelationDown LinkRelation = "down"
 	// LinkRelationDown defines the target note as a parent of the source.
 	LinkRelationUp LinkRelation = "up"
+	// LinkRelationParent defines the target note as the parent of the source
+	// declared in its frontmatter.
+	LinkRelationParent LinkRelation = "parent"
+	// LinkRelationCanonical defines the target note as the canonical version
+	// of the source, e.g. after merging duplicates.
+	LinkRelationCanonical LinkRelation = "canonical"
 )
 
 // LinkRels creates a slice of LinkRelation from a list of strings.
@@ -4,6 +4,8 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 	"time"
 
@@ -22,24 +24,486 @@ type NoteParser interface {
 // NoteContentParser parses a note's raw content into its components.
 type NoteContentParser interface {
 	ParseNoteContent(content string) (*NoteContent, error)
+	// ParseNoteContentAt parses the content of the note at the given path,
+	// which completes the fields derived from the file name.
+	ParseNoteContentAt(path string, content string) (*NoteContent, error)
 }
 
 // NoteContent holds the data parsed from the note content.
 type NoteContent struct {
 	// Title is the heading of the note.
 	Title opt.String
+	// SortTitle is the title used to sort the note in listings, e.g. `Great
+	// Gatsby, The`. It defaults to Title.
+	SortTitle opt.String
+	// LuhmannID is the Luhmann-style ID of the note, e.g. `1a2b`, found at
+	// the start of its title or file name.
+	LuhmannID opt.String
+	// RawTitle is the title as written in the note, with any Markdown markup,
+	// e.g. `*Hello* world`. It is identical to Title when declared in the
+	// frontmatter.
+	RawTitle opt.String
+	// BodyTitle is the text of the first level 1 heading in the note, even
+	// when the Title is declared in the frontmatter.
+	BodyTitle opt.String
 	// Lead is the opening paragraph or section of the note.
 	Lead opt.String
+	// Preview is a short plain text summary of the note for listings, either
+	// declared in the frontmatter or made of the first words of the body.
+	Preview opt.String
 	// Body is the content of the note, including the Lead but without the Title.
 	Body opt.String
+	// Rest is the content of the Body following the Lead.
+	Rest opt.String
+	// Sections are the parts of the Body delimited by thematic breaks, e.g.
+	// `---`.
+	Sections []Section
+	// Headings is the outline of the note.
+	Headings []Heading
+	// Anchors is the list of fragments which can be linked to in the note,
+	// from its headings and HTML anchors such as `<a name="x"></a>`.
+	Anchors []string
 	// Tags is the list of tags found in the note content.
 	Tags []string
+	// Keywords is the list of weighted search keywords declared in the
+	// frontmatter, e.g. `keywords: [go:2, testing]`.
+	Keywords []Keyword
 	// Links is the list of outbound links found in the note.
 	Links []Link
+	// ChildLinks is the ordered list of wiki links found in the first
+	// top-level list of the note, e.g. the children of an index note. It is
+	// only set when enabled in the parser.
+	ChildLinks []Link
+	// Parent is the target of the parent note declared in the frontmatter,
+	// e.g. `up: "[[Index]]"`.
+	Parent opt.String
+	// Canonical is the target of the canonical note declared in the
+	// frontmatter, when this note is a duplicate, e.g. `[[Real Note]]`.
+	Canonical opt.String
+	// Citations is the list of Pandoc citation keys found in the note, e.g.
+	// [@smith2020].
+	Citations []string
+	// Mentions is the list of people mentioned in the note, e.g. @alice.
+	Mentions []string
+	// DateMentions is the list of unique dates mentioned in the note text,
+	// e.g. `2021-05-01`, when enabled.
+	DateMentions []time.Time
+	// EarliestDate is the earliest of the DateMentions, if any.
+	EarliestDate time.Time
+	// LatestDate is the latest of the DateMentions, if any.
+	LatestDate time.Time
 	// Additional metadata. For example, extracted from a YAML frontmatter.
 	Metadata map[string]interface{}
+	// FrontmatterFormat is the format of the note's frontmatter, if any.
+	FrontmatterFormat FrontmatterFormat
+	// ConsumedKeys is the sorted list of frontmatter keys used to fill the
+	// other fields, e.g. `title`.
+	ConsumedKeys []string
+	// Visibility indicates whether the note should be published.
+	Visibility Visibility
+	// IsMOC indicates whether the note is a Map of Content, i.e. a structure
+	// note.
+	IsMOC bool
+	// Status is the workflow status of the note, e.g. `draft`.
+	Status opt.String
+	// Priority is the priority of the note, e.g. `high`.
+	Priority opt.String
+	// Difficulty is the estimated difficulty of the note, e.g. `3`.
+	Difficulty opt.Int
+	// IsPinned indicates whether the note is pinned or a favorite, e.g.
+	// `pinned: true`.
+	IsPinned bool
+	// Slug is the explicit slug or permalink of the note, as written in the
+	// frontmatter.
+	Slug opt.String
+	// Template is the name of the template the note was created from, as
+	// recorded in the frontmatter, e.g. `daily`.
+	Template opt.String
+	// Weight is the explicit order of the note in listings, if any.
+	Weight opt.Int
+	// Series is the first series the note belongs to, e.g. a tutorial.
+	Series opt.String
+	// SeriesList is the list of all the series the note belongs to.
+	SeriesList []string
+	// SeriesOrder is the position of the note in its series, if any.
+	SeriesOrder opt.Int
+	// Created is the creation date declared in the note, if any, in its
+	// original time zone.
+	Created time.Time
+	// CreatedUTC is the creation date normalized to UTC, e.g. for sorting.
+	CreatedUTC time.Time
+	// Modified is the last modification date declared in the note, if any.
+	Modified time.Time
+	// InlineMetadata holds the Dataview-style `key:: value` fields found in
+	// the note body.
+	InlineMetadata map[string][]string
+	// CodeKeywords is the list of unique inline code spans found in the
+	// note, e.g. symbol names.
+	CodeKeywords []string
+	// NoIndex indicates whether the note opted out of indexing with a
+	// `<!-- zk:noindex -->` directive.
+	NoIndex bool
+	// Footnotes is the list of footnotes found in the note.
+	Footnotes []Footnote
+	// Callouts is the list of Obsidian callouts found in the note, e.g.
+	// `> [!note]`.
+	Callouts []Callout
+	// Tables is the list of GFM tables found in the note.
+	Tables []Table
+	// Images is the list of images embedded in the note, either with the
+	// Markdown syntax or an HTML <img> tag.
+	Images []Image
+	// Attachments is the list of paths of the files attached to the note in
+	// the frontmatter, e.g. `attachments: [report.pdf]`.
+	Attachments []string
+	// DeclaredBacklinks is the list of notes declared as linking to this one
+	// in the frontmatter, e.g. `backlinks: ["[[Index]]"]`. They are not part
+	// of Links.
+	DeclaredBacklinks []string
+	// HasSelfEmbed indicates whether the note embeds itself, e.g.
+	// `![[This Note]]`, which would loop forever when rendered.
+	HasSelfEmbed bool
+	// Lists is the list of top-level lists found in the note, when enabled.
+	Lists []List
+	// Stats holds the number of structural elements in the note.
+	Stats NoteStats
+	// Color is the accent color declared in the frontmatter, e.g. `#ff8800`.
+	Color opt.String
+	// CSSClasses is the list of CSS classes styling the note, as declared
+	// with Obsidian's `cssclasses` frontmatter key.
+	CSSClasses []string
+	// Icon is the icon displayed next to the note, usually an emoji, e.g.
+	// `icon: 📕`. It is kept as written.
+	Icon opt.String
+	// Geo holds the coordinates of the place the note is about, if any.
+	Geo *Geo
+	// DetectedLang is the ISO 639-1 code of the language guessed from the
+	// body, e.g. `en`, when the detection is enabled and conclusive.
+	DetectedLang opt.String
+	// DetectedLangConfidence is the ratio between 0 and 1 of the detection
+	// clues matching DetectedLang.
+	DetectedLangConfidence float64
+	// Warnings is the list of non-fatal issues found while parsing the note.
+	Warnings []string
 }
 
+// LinkCounts returns the number of occurrences of each internal link target
+// in the note, e.g. to display backlink counts. Targets are grouped without
+// their file extension, fragment or block ID.
+func (c *NoteContent) LinkCounts() map[string]int {
+	counts := map[string]int{}
+	for _, link := range c.Links {
+		if link.IsExternal {
+			continue
+		}
+		target := link.Target
+		if target == "" {
+			target = link.Href
+		}
+		if i := strings.IndexAny(target, "#^"); i != -1 {
+			target = target[:i]
+		}
+		if target = strings.TrimSpace(target); target != "" {
+			counts[target]++
+		}
+	}
+	return counts
+}
+
+// Assets returns the paths of the local files used by the note, from its
+// attachments and images. Remote images are skipped.
+func (c *NoteContent) Assets() []string {
+	assets := append([]string{}, c.Attachments...)
+	for _, image := range c.Images {
+		if image.Src != "" && !strutil.IsURL(image.Src) {
+			assets = append(assets, image.Src)
+		}
+	}
+	return strutil.RemoveDuplicates(assets)
+}
+
+// InternalLinkCount returns the number of links to other notes or local
+// files, including the embeds such as `![[note]]`.
+func (c *NoteContent) InternalLinkCount() int {
+	count := 0
+	for _, link := range c.Links {
+		if !link.IsExternal {
+			count++
+		}
+	}
+	return count
+}
+
+// ExternalLinkCount returns the number of links to remote resources.
+func (c *NoteContent) ExternalLinkCount() int {
+	return len(c.Links) - c.InternalLinkCount()
+}
+
+// Position locates an element in the source of a note.
+type Position struct {
+	// Offset is the byte offset of the element.
+	Offset int
+	// Line is the 1-based line number of the element.
+	Line int
+	// Column is the 1-based column of the element, counted in characters.
+	Column int
+}
+
+// Heading represents a heading of the note outline.
+type Heading struct {
+	// Level of the heading, from 1 to 6.
+	Level int
+	// Text of the heading, without any Markdown markup.
+	Text string
+	// Anchor is the fragment used to link to the heading, e.g. `a-heading`.
+	Anchor string
+	// WordCount is the number of words in the section of the heading, until
+	// the next heading of equal or higher level. Code blocks are excluded.
+	WordCount int
+}
+
+// Section is a part of a note body delimited by thematic breaks.
+type Section struct {
+	// Text is the Markdown content of the section.
+	Text string
+	// Start byte offset of the section in the note content.
+	Start int
+	// End byte offset of the section in the note content.
+	End int
+}
+
+// Footnote represents a footnote of the note.
+type Footnote struct {
+	// Label of a reference footnote, e.g. `1` for [^1]. Inline footnotes
+	// don't have any label.
+	Label string
+	// Text is the plain text content of the footnote.
+	Text string
+	// Indicates whether the footnote is written inline, e.g. ^[A footnote].
+	Inline bool
+}
+
+// Callout represents an Obsidian callout block, as plain text.
+type Callout struct {
+	// Type of the callout, e.g. `warning` for `> [!warning]`.
+	Type string
+	// Optional title following the type.
+	Title string
+	// Body is the content of the callout.
+	Body string
+}
+
+// Table holds the cells of a table found in a note, as plain text.
+type Table struct {
+	Header []string
+	Rows   [][]string
+}
+
+// Keyword holds a search keyword declared in a note, with its weight.
+type Keyword struct {
+	Term string
+	// Weight is used to boost the keyword in search results. Defaults to 1.
+	Weight float64
+}
+
+// Image holds an image embedded in a note.
+type Image struct {
+	Src string
+	Alt string
+	// HTML indicates whether the image was embedded with an HTML <img> tag.
+	HTML bool
+}
+
+// List holds the raw Markdown text of a top-level list found in a note.
+type List struct {
+	Text string
+	// Ordered indicates whether the list is numbered.
+	Ordered bool
+	// Depth is the maximum nesting depth of the list items, starting at 1.
+	Depth int
+}
+
+// Geo holds geographic coordinates, in decimal degrees.
+type Geo struct {
+	Lat float64
+	Lng float64
+}
+
+// Equal returns whether both coordinates are identical or nil.
+func (g *Geo) Equal(other *Geo) bool {
+	if g == nil || other == nil {
+		return g == other
+	}
+	return *g == *other
+}
+
+// Equal returns whether both note contents hold the same data.
+//
+// The tags, links, citations, mentions and code keywords are compared
+// regardless of their order, as they are sets of elements found anywhere in
+// the note. The other lists, such as the headings or sections, must be in the
+// same order. nil and empty lists or maps are considered equal.
+func (c *NoteContent) Equal(other *NoteContent) bool {
+	if c == nil || other == nil {
+		return c == other
+	}
+
+	return c.Title.Equal(other.Title) &&
+		c.BodyTitle.Equal(other.BodyTitle) &&
+		c.Lead.Equal(other.Lead) &&
+		c.RawTitle.Equal(other.RawTitle) &&
+		c.SortTitle.Equal(other.SortTitle) &&
+		c.LuhmannID.Equal(other.LuhmannID) &&
+		c.Body.Equal(other.Body) &&
+		c.Rest.Equal(other.Rest) &&
+		c.Preview.Equal(other.Preview) &&
+		equalLists(c.Sections, other.Sections) &&
+		equalLists(c.Headings, other.Headings) &&
+		equalStringSets(c.Tags, other.Tags) &&
+		equalLists(c.Keywords, other.Keywords) &&
+		equalLinkSets(c.Links, other.Links) &&
+		equalLists(c.ChildLinks, other.ChildLinks) &&
+		c.Parent.Equal(other.Parent) &&
+		c.Canonical.Equal(other.Canonical) &&
+		equalStringSets(c.Citations, other.Citations) &&
+		equalStringSets(c.Mentions, other.Mentions) &&
+		equalLists(c.DateMentions, other.DateMentions) &&
+		c.EarliestDate.Equal(other.EarliestDate) &&
+		c.LatestDate.Equal(other.LatestDate) &&
+		equalMaps(c.Metadata, other.Metadata) &&
+		c.FrontmatterFormat == other.FrontmatterFormat &&
+		equalLists(c.ConsumedKeys, other.ConsumedKeys) &&
+		c.Visibility == other.Visibility &&
+		c.IsMOC == other.IsMOC &&
+		c.Status.Equal(other.Status) &&
+		c.Priority.Equal(other.Priority) &&
+		c.Difficulty.Equal(other.Difficulty) &&
+		c.IsPinned == other.IsPinned &&
+		c.Slug.Equal(other.Slug) &&
+		c.Template.Equal(other.Template) &&
+		c.Weight.Equal(other.Weight) &&
+		c.Series.Equal(other.Series) &&
+		equalLists(c.SeriesList, other.SeriesList) &&
+		c.SeriesOrder.Equal(other.SeriesOrder) &&
+		c.Created.Equal(other.Created) &&
+		c.CreatedUTC.Equal(other.CreatedUTC) &&
+		c.Modified.Equal(other.Modified) &&
+		equalMaps(c.InlineMetadata, other.InlineMetadata) &&
+		equalStringSets(c.CodeKeywords, other.CodeKeywords) &&
+		c.NoIndex == other.NoIndex &&
+		equalLists(c.Footnotes, other.Footnotes) &&
+		equalLists(c.Callouts, other.Callouts) &&
+		equalLists(c.Tables, other.Tables) &&
+		equalLists(c.Lists, other.Lists) &&
+		equalLists(c.Images, other.Images) &&
+		equalLists(c.Attachments, other.Attachments) &&
+		equalLists(c.DeclaredBacklinks, other.DeclaredBacklinks) &&
+		c.HasSelfEmbed == other.HasSelfEmbed &&
+		c.Stats == other.Stats &&
+		c.Color.Equal(other.Color) &&
+		equalLists(c.CSSClasses, other.CSSClasses) &&
+		c.Icon.Equal(other.Icon) &&
+		c.Geo.Equal(other.Geo) &&
+		c.DetectedLang.Equal(other.DetectedLang) &&
+		c.DetectedLangConfidence == other.DetectedLangConfidence &&
+		equalLists(c.Anchors, other.Anchors) &&
+		equalLists(c.Warnings, other.Warnings)
+}
+
+// equalLists returns whether the given slices hold the same elements in the
+// same order.
+func equalLists(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Len() != vb.Len() {
+		return false
+	}
+	for i := 0; i < va.Len(); i++ {
+		if !reflect.DeepEqual(va.Index(i).Interface(), vb.Index(i).Interface()) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalMaps returns whether the given maps hold the same entries.
+func equalMaps(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Len() == 0 && vb.Len() == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// equalStringSets returns whether the given slices hold the same strings,
+// regardless of their order.
+func equalStringSets(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sa := append([]string{}, a...)
+	sb := append([]string{}, b...)
+	sort.Strings(sa)
+	sort.Strings(sb)
+	return equalLists(sa, sb)
+}
+
+// equalLinkSets returns whether the given slices hold the same links,
+// regardless of their order.
+func equalLinkSets(a, b []Link) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	matched := make([]bool, len(b))
+outer:
+	for _, la := range a {
+		for i, lb := range b {
+			if !matched[i] && reflect.DeepEqual(la, lb) {
+				matched[i] = true
+				continue outer
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// NoteStats holds the number of structural elements found in a note, for
+// example to compute a complexity score.
+type NoteStats struct {
+	Headings   int
+	Links      int
+	Images     int
+	CodeBlocks int
+	ListItems  int
+	// Words is the number of words of the text, excluding the headings and
+	// code blocks.
+	Words int
+}
+
+// FrontmatterFormat represents the serialization format of a note
+// frontmatter.
+//
+// The frontmatters fenced with `---` are YAML, unless they hold a JSON object
+// or the opening fence has a `json` info string, e.g. `--- json`. The ones
+// fenced with `+++` are TOML.
+type FrontmatterFormat string
+
+const (
+	FrontmatterFormatNone FrontmatterFormat = ""
+	FrontmatterFormatYAML FrontmatterFormat = "yaml"
+	FrontmatterFormatTOML FrontmatterFormat = "toml"
+	FrontmatterFormatJSON FrontmatterFormat = "json"
+)
+
+// Visibility represents whether a note is meant to be published.
+type Visibility string
+
+const (
+	VisibilityUnspecified Visibility = ""
+	VisibilityPublic      Visibility = "public"
+	VisibilityPrivate     Visibility = "private"
+)
+
 // ParseNoteAt implements NoteParser.
 func (n *Notebook) ParseNoteAt(absPath string) (*Note, error) {
 	wrap := errors.Wrapper(absPath)
@@ -61,7 +525,7 @@ func (n *Notebook) ParseNoteWithContent(absPath string, content []byte) (*Note,
 	}
 
 	contentStr := string(content)
-	contentParts, err := n.Parser.ParseNoteContent(contentStr)
+	contentParts, err := n.Parser.ParseNoteContentAt(absPath, contentStr)
 	if err != nil {
 		return nil, wrap(err)
 	}
@@ -95,13 +559,18 @@ func (n *Notebook) ParseNoteWithContent(absPath string, content []byte) (*Note,
 	times, err := times.Stat(absPath)
 	if err == nil {
 		note.Modified = times.ModTime().UTC()
-		note.Created = creationDateFrom(note.Metadata, times)
+		note.Created = creationDateFrom(contentParts.Created, note.Metadata, times)
 	}
 
 	return &note, nil
 }
 
-func creationDateFrom(metadata map[string]interface{}, times times.Timespec) time.Time {
+func creationDateFrom(created time.Time, metadata map[string]interface{}, times times.Timespec) time.Time {
+	// Prefer the creation date found by the content parser.
+	if !created.IsZero() {
+		return created
+	}
+
 	// Read the creation date from the YAML frontmatter `date` key.
 	if dateVal, ok := metadata["date"]; ok {
 		if dateStr, ok := dateVal.(string); ok {
@@ -1,5 +1,13 @@
 package core
 
+import (
+	"testing"
+	"time"
+
+	"github.com/zk-org/zk/internal/util/opt"
+	"github.com/zk-org/zk/internal/util/test/assert"
+)
+
 type noteContentParserMock struct {
 	results map[string]*NoteContent
 }
@@ -16,3 +24,112 @@ func (p *noteContentParserMock) ParseNoteContent(content string) (*NoteContent,
 	}
 	return &NoteContent{}, nil
 }
+
+func (p *noteContentParserMock) ParseNoteContentAt(path string, content string) (*NoteContent, error) {
+	return p.ParseNoteContent(content)
+}
+
+func TestNoteContentLinkCounts(t *testing.T) {
+	test := func(links []Link, expected map[string]int) {
+		content := NoteContent{Links: links}
+		assert.Equal(t, content.LinkCounts(), expected)
+	}
+
+	test([]Link{}, map[string]int{})
+	test([]Link{
+		{Href: "A", Target: "A"},
+		{Href: "B", Target: "B"},
+		{Href: "A#section", Target: "A", Fragment: "section"},
+	}, map[string]int{"A": 2, "B": 1})
+	test([]Link{
+		{Href: "A.md", Target: "A", Ext: "md"},
+		{Href: "A#^block-id", Target: "A", Fragment: "^block-id"},
+		{Href: "A^block-id"},
+		{Href: "#section", Fragment: "section"},
+		{Href: "https://example.com", IsExternal: true},
+	}, map[string]int{"A": 3})
+}
+
+func TestNoteContentAssets(t *testing.T) {
+	test := func(attachments []string, images []Image, expected []string) {
+		content := NoteContent{Attachments: attachments, Images: images}
+		assert.Equal(t, content.Assets(), expected)
+	}
+
+	test([]string{}, []Image{}, []string{})
+	test([]string{"a.pdf", "b.png"}, []Image{
+		{Src: "c.png"},
+		{Src: "https://example.com/d.png"},
+		{Src: "b.png", HTML: true},
+	}, []string{"a.pdf", "b.png", "c.png"})
+}
+
+func TestNoteContentLinkCountsByKind(t *testing.T) {
+	test := func(links []Link, internal int, external int) {
+		content := NoteContent{Links: links}
+		assert.Equal(t, content.InternalLinkCount(), internal)
+		assert.Equal(t, content.ExternalLinkCount(), external)
+	}
+
+	test([]Link{}, 0, 0)
+	test([]Link{
+		{Href: "A", Type: LinkTypeWikiLink},
+		{Href: "B.md", Type: LinkTypeMarkdown},
+		{Href: "C", Type: LinkTypeWikiLink},
+		{Href: "https://example.com", Type: LinkTypeImplicit, IsExternal: true},
+	}, 3, 1)
+}
+
+func TestNoteContentEqual(t *testing.T) {
+	newContent := func() *NoteContent {
+		return &NoteContent{
+			Title: opt.NewString("A title"),
+			Body:  opt.NewString("Body"),
+			Headings: []Heading{
+				{Level: 1, Text: "A title", Anchor: "a-title"},
+				{Level: 2, Text: "Section", Anchor: "section"},
+			},
+			Tags: []string{"a", "b", "c"},
+			Links: []Link{
+				{Href: "a", Rels: LinkRels("up")},
+				{Href: "b"},
+			},
+			Metadata: map[string]interface{}{"author": "Alice"},
+			Weight:   opt.NewInt(2),
+			Modified: time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC),
+		}
+	}
+
+	test := func(modify func(c *NoteContent), expected bool) {
+		content := newContent()
+		modify(content)
+		assert.Equal(t, newContent().Equal(content), expected)
+		assert.Equal(t, content.Equal(newContent()), expected)
+	}
+
+	test(func(c *NoteContent) {}, true)
+	test(func(c *NoteContent) { c.Tags = []string{"c", "a", "b"} }, true)
+	test(func(c *NoteContent) { c.Links[0], c.Links[1] = c.Links[1], c.Links[0] }, true)
+	test(func(c *NoteContent) { c.Warnings = []string{} }, true)
+	test(func(c *NoteContent) { c.Modified = c.Modified.In(time.FixedZone("UTC+2", 2*60*60)) }, true)
+
+	test(func(c *NoteContent) { c.Title = opt.NewString("Other") }, false)
+	test(func(c *NoteContent) { c.Tags = []string{"a", "b"} }, false)
+	test(func(c *NoteContent) { c.Tags = []string{"a", "b", "b"} }, false)
+	test(func(c *NoteContent) { c.Links[1].Href = "c" }, false)
+	test(func(c *NoteContent) { c.Headings[0], c.Headings[1] = c.Headings[1], c.Headings[0] }, false)
+	test(func(c *NoteContent) { c.Metadata["author"] = "Bob" }, false)
+	test(func(c *NoteContent) { c.Weight = opt.NullInt }, false)
+	test(func(c *NoteContent) { c.Stats.Links = 1 }, false)
+
+	assert.True(t, (*NoteContent)(nil).Equal(nil))
+	assert.False(t, newContent().Equal(nil))
+}
+
+func TestCreationDateFromPrefersParsedDate(t *testing.T) {
+	created := time.Date(2021, 3, 4, 5, 6, 7, 0, time.FixedZone("CET", 3600))
+	metadata := map[string]interface{}{"date": "2020-01-01T00:00:00Z"}
+
+	assert.Equal(t, creationDateFrom(created, metadata, nil), created)
+	assert.Equal(t, creationDateFrom(time.Time{}, metadata, nil), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+}
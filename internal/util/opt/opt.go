@@ -164,3 +164,53 @@ func (s Bool) MarshalJSON() ([]byte, error) {
 		return []byte("false"), nil
 	}
 }
+
+// Int holds an optional integer value.
+type Int struct {
+	Value *int
+}
+
+// NullInt represents an empty optional Int.
+var NullInt = Int{nil}
+
+// NewInt creates a new optional Int with the given value.
+func NewInt(value int) Int {
+	return Int{&value}
+}
+
+// IsNull returns whether the optional Int has no value.
+func (s Int) IsNull() bool {
+	return s.Value == nil
+}
+
+// Or returns the receiver if it is not null, otherwise the given optional
+// Int.
+func (s Int) Or(other Int) Int {
+	if s.IsNull() {
+		return other
+	} else {
+		return s
+	}
+}
+
+// Unwrap returns the optional Int value or 0 if none is set.
+func (s Int) Unwrap() int {
+	if s.IsNull() {
+		return 0
+	} else {
+		return *s.Value
+	}
+}
+
+func (s Int) Equal(other Int) bool {
+	return s.Value == other.Value ||
+		(s.Value != nil && other.Value != nil && *s.Value == *other.Value)
+}
+
+func (s Int) MarshalJSON() ([]byte, error) {
+	if s.IsNull() {
+		return []byte("null"), nil
+	} else {
+		return []byte(fmt.Sprint(*s.Value)), nil
+	}
+}